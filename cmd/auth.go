@@ -20,14 +20,11 @@
 package cmd
 
 import (
-	"bufio"
 	"fmt"
 	"os"
-	"strings"
 	"time"
 
 	"github.com/jasonamyers/portray/util"
-	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -37,6 +34,7 @@ var userName string
 var tokenCode string
 var profile string
 var noMfa bool
+var authDuration time.Duration
 
 // authCmd represents the auth command
 var authCmd = &cobra.Command{
@@ -44,10 +42,15 @@ var authCmd = &cobra.Command{
 	Short: "establishes an MFA session via STS",
 	Long:  `The auth command helps you authenticate via MFA.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		checkNesting()
 		noMfa = viper.GetBool("NoMfa")
 
+		// the key of the profile in the AuthProfiles section
+		var configKey string
+
 		// User specified profile
 		if profile != "" {
+			configKey = profile
 			// validate it against Portray config
 			if viper.IsSet("AuthProfiles." + profile) {
 				profileKey := "AuthProfiles." + profile + "."
@@ -93,6 +96,7 @@ var authCmd = &cobra.Command{
 			// user has not specified account
 			// try to find default from config
 			if accountId == "" {
+				configKey = "default"
 				defaultAccountId := viper.GetString("AuthProfiles.default.AccountId")
 				defaultUserName := viper.GetString("AuthProfiles.default.UserName")
 				defaultProfileName := viper.GetString("AuthProfiles.default.Name")
@@ -136,42 +140,42 @@ var authCmd = &cobra.Command{
 			}
 		}
 
-		home, err := homedir.Dir()
+		// pick up the remaining settings of a configured profile
+		var authProfile AwsAuthProfile
+		err := viper.UnmarshalKey("AuthProfiles."+configKey, &authProfile)
 		util.CheckError(err)
-		fileName := home + "/.aws/portray-session-" + profile + ".json"
-		awsCreds := util.GetCredsFromFile(fileName)
-
-		// If there's no valid session cache, generate a new session. Prompt
-		// for MFA token if it's not passed, unless the --no-mfa flag is set.
-		if awsCreds.SessionToken == "" || !util.ValidateSession(awsCreds) {
-			if tokenCode == "" {
-				if noMfa {
-					fmt.Println("Skipping MFA token prompting")
-				} else {
-					// Prompt for MFA token
-					reader := bufio.NewReader(os.Stdin)
-					fmt.Print("Enter token: ")
-					token, _ := reader.ReadString('\n')
-					tokenCode = strings.TrimSpace(token)
-				}
-			}
-
-			awsCreds = util.GetNewSession(profile, accountId, userName, tokenCode)
-			util.WriteSessionFile(awsCreds, fileName)
-		} else {
-			// Found a cached sessions that's still valid
-			fmt.Println("Using cached session credentials")
-
-			// Check how much time is left on the session so we can tell the user
-			sessionExpiration := time.Unix(awsCreds.Expiration, 0)
-			currentTime := time.Now()
-			sessionTimeLeft := sessionExpiration.Sub(currentTime)
-
-			fmt.Printf("Session valid for %+v\n", util.Round(sessionTimeLeft, time.Second))
+		// the Name is the AWS profile the session is started with
+		if authProfile.Name == "" {
+			authProfile.Name = profile
 		}
-
-		util.SessionToEnvVars(awsCreds, accountId, "", profile)
-		util.StartShell(accountId)
+		authProfile.Env = configEnv("AuthProfiles", configKey, authProfile.Env)
+		authProfile.AccountId = accountId
+		authProfile.UserName = userName
+
+		awsCreds := loadAuthSession(
+			authProfile,
+			sessionOptions{
+				TokenCode:       tokenCode,
+				NoMfa:           noMfa,
+				DurationSeconds: int64(authDuration.Seconds()),
+				MinRemaining:    minRemaining,
+			})
+
+		// PORTRAY_PROFILE names the config key, so other commands can look
+		// the profile up again
+		infoProfile := configKey
+		if infoProfile == "" {
+			infoProfile = authProfile.Name
+		}
+		info := util.SessionInfo{
+			AccountId: accountId,
+			Profile:   infoProfile,
+			Region:    profileEndpoint(authProfile.Region, "", "").Region,
+			Env:       profileEnv(authProfile.Env),
+		}
+		info = withPrompt(info, authProfile.AccountAlias, authProfile.Environment, authProfile.PromptColor)
+		// auth sessions need an MFA token, so they can't be renewed
+		startShell(accountId, awsCreds, info, authCacheKey(authProfile), nil, 0)
 	},
 }
 
@@ -183,6 +187,8 @@ func init() {
 	authCmd.Flags().StringVarP(&tokenCode, "token", "t", "", "an MFA token")
 	authCmd.Flags().StringVarP(&profile, "profile", "p", "", "a name for your profile")
 	authCmd.Flags().BoolP("no-mfa", "n", false, "disable MFA")
+	authCmd.Flags().DurationVar(&authDuration, "duration", 0, "the session duration, e.g. 8h (default 12h or the profile's DurationSeconds)")
+	addShellFlags(authCmd)
 
 	viper.BindPFlag("AccountId", authCmd.Flags().Lookup("account"))
 	viper.BindPFlag("UserName", authCmd.Flags().Lookup("username"))
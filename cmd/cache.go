@@ -0,0 +1,459 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jasonamyers/portray/util"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "manage the session cache",
+	Long: `The cache command manages the session files Portray caches in the
+~/.aws/ directory, or the CacheDir set in the config.`,
+}
+
+var cacheOutput string
+var purgeExpired bool
+var purgeAll bool
+
+// cacheListCmd represents the cache list command
+var cacheListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "lists cached sessions",
+	Long: `The list command shows the profile, account and role of each cached
+session, and how long it has left.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		keys, err := cacheStore.List()
+		util.CheckError(err)
+
+		var entries []cacheEntry
+		for _, key := range keys {
+			awsCreds, err := cacheStore.Get(key)
+			util.CheckError(err)
+			entries = append(entries, newCacheEntry(key, awsCreds))
+		}
+
+		switch cacheOutput {
+		case "table":
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "PROFILE\tACCOUNT\tROLE\tREMAINING\tEXPIRED")
+			for _, entry := range entries {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\n",
+					orDash(entry.Profile), orDash(entry.AccountId), orDash(entry.RoleName), entry.Remaining, entry.Expired)
+			}
+			w.Flush()
+		case "json":
+			printJSON(entries)
+		default:
+			fmt.Printf("Unknown output format %s! Valid values are table and json\n", cacheOutput)
+			os.Exit(1)
+		}
+	},
+}
+
+// cacheShowCmd represents the cache show command
+var cacheShowCmd = &cobra.Command{
+	Use:   "show <profile>",
+	Short: "shows the cached session of a profile",
+	Long: `The show command prints the cached session of a profile, with its
+secret key and session token redacted.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		key, awsCreds := profileCachedSession(args[0])
+		if key == "" {
+			fmt.Printf("No cached session for the %s profile\n", args[0])
+			os.Exit(1)
+		}
+
+		entry := newCacheEntry(key, awsCreds)
+		entry.AccessKeyID = redact(awsCreds.AccessKeyID, 4)
+		entry.SecretAccessKey = redact(awsCreds.SecretAccessKey, 0)
+		entry.SessionToken = redact(awsCreds.SessionToken, 0)
+
+		switch cacheOutput {
+		case "table":
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "Key:\t%s\n", entry.Key)
+			fmt.Fprintf(w, "Profile:\t%s\n", orDash(entry.Profile))
+			fmt.Fprintf(w, "AccountId:\t%s\n", orDash(entry.AccountId))
+			fmt.Fprintf(w, "RoleName:\t%s\n", orDash(entry.RoleName))
+			fmt.Fprintf(w, "AccessKeyID:\t%s\n", entry.AccessKeyID)
+			fmt.Fprintf(w, "SecretAccessKey:\t%s\n", entry.SecretAccessKey)
+			fmt.Fprintf(w, "SessionToken:\t%s\n", entry.SessionToken)
+			fmt.Fprintf(w, "Expiration:\t%s\n", entry.Expiration)
+			fmt.Fprintf(w, "Remaining:\t%s\n", entry.Remaining)
+			fmt.Fprintf(w, "Expired:\t%t\n", entry.Expired)
+			fmt.Fprintf(w, "Version:\t%d\n", entry.Version)
+			if metadata := awsCreds.Metadata; metadata.IssuedAt != 0 {
+				fmt.Fprintf(w, "IssuedAt:\t%s\n", time.Unix(metadata.IssuedAt, 0).Format(time.RFC3339))
+			}
+			fmt.Fprintf(w, "SourceProfile:\t%s\n", orDash(awsCreds.Metadata.SourceProfile))
+			fmt.Fprintf(w, "RoleArn:\t%s\n", orDash(awsCreds.Metadata.RoleArn))
+			fmt.Fprintf(w, "SessionName:\t%s\n", orDash(awsCreds.Metadata.SessionName))
+			fmt.Fprintf(w, "Region:\t%s\n", orDash(awsCreds.Metadata.Region))
+			fmt.Fprintf(w, "ExternalId:\t%s\n", orDash(awsCreds.Metadata.ExternalId))
+			if awsCreds.Metadata.MfaUnknown {
+				fmt.Fprintln(w, "MfaUsed:\tunknown")
+			} else {
+				fmt.Fprintf(w, "MfaUsed:\t%t\n", awsCreds.Metadata.MfaUsed)
+			}
+			w.Flush()
+		case "json":
+			printJSON(entry)
+		default:
+			fmt.Printf("Unknown output format %s! Valid values are table and json\n", cacheOutput)
+			os.Exit(1)
+		}
+	},
+}
+
+// cachePurgeCmd represents the cache purge command
+var cachePurgeCmd = &cobra.Command{
+	Use:   "purge [--expired|--all|<profile>]",
+	Short: "deletes cached sessions",
+	Long: `The purge command deletes the cached session of a profile, every
+expired session with --expired, or every session with --all. The lock files
+of deleted sessions are removed too, unless a portray process holds them.
+On Windows, lock files are left in place.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		modes := len(args)
+		if purgeExpired {
+			modes++
+		}
+		if purgeAll {
+			modes++
+		}
+		if modes != 1 {
+			fmt.Println("Error! Pass one of --expired, --all or a profile name")
+			os.Exit(1)
+		}
+
+		var keys []string
+		if len(args) == 1 {
+			key, _ := profileCachedSession(args[0])
+			if key == "" {
+				fmt.Printf("No cached session for the %s profile\n", args[0])
+				os.Exit(1)
+			}
+			keys = []string{key}
+		} else {
+			var err error
+			keys, err = cacheStore.List()
+			util.CheckError(err)
+		}
+
+		for _, key := range keys {
+			if purgeExpired {
+				// Sessions that couldn't be read are left alone, in
+				// case they're encrypted with another passphrase.
+				awsCreds, err := cacheStore.Get(key)
+				util.CheckError(err)
+				if awsCreds.SessionToken == "" || util.ValidateSession(awsCreds) {
+					continue
+				}
+			}
+
+			err := cacheStore.Delete(key)
+			util.CheckError(err)
+			err = util.RemoveLockFile(sessionLockPath(key))
+			util.CheckError(err)
+			fmt.Printf("Deleted %s\n", key)
+		}
+
+		if purgeAll {
+			// locks of sessions that were never cached, or cached in
+			// another backend
+			locks, err := filepath.Glob(filepath.Join(cacheDir(), "portray-*.lock"))
+			util.CheckError(err)
+			for _, path := range locks {
+				err := util.RemoveLockFile(path)
+				util.CheckError(err)
+			}
+		}
+	},
+}
+
+// cacheDirCmd represents the cache dir command
+var cacheDirCmd = &cobra.Command{
+	Use:   "dir",
+	Short: "prints the cache directory",
+	Long: `The dir command prints the directory session files and their locks
+are kept in.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(cacheDir())
+	},
+}
+
+// cacheMigrateCmd represents the cache migrate command
+var cacheMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "encrypts plaintext session files",
+	Long: `The migrate command encrypts any plaintext session files in the cache.
+The encrypted-file CacheBackend must be configured, and CacheKeyFile set if a
+key file is used instead of a passphrase.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		store, ok := cacheStore.(*util.FileStore)
+		if !ok || !store.Encrypted() {
+			fmt.Println("Error! Set CacheBackend to encrypted-file in the config to enable cache encryption first")
+			os.Exit(1)
+		}
+
+		keys, err := store.List()
+		util.CheckError(err)
+
+		for _, key := range keys {
+			data, err := ioutil.ReadFile(store.Path(key))
+			util.CheckError(err)
+			if util.IsEncrypted(data) {
+				continue
+			}
+
+			awsCreds, err := store.Get(key)
+			util.CheckError(err)
+			err = store.Put(key, awsCreds)
+			util.CheckError(err)
+
+			fmt.Printf("Encrypted %s\n", store.Path(key))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheMigrateCmd)
+	cacheCmd.AddCommand(cacheListCmd)
+	cacheCmd.AddCommand(cacheShowCmd)
+	cacheCmd.AddCommand(cachePurgeCmd)
+	cacheCmd.AddCommand(cacheDirCmd)
+
+	cacheListCmd.Flags().StringVarP(&cacheOutput, "output", "o", "table", "the output format, table or json")
+	cacheShowCmd.Flags().StringVarP(&cacheOutput, "output", "o", "table", "the output format, table or json")
+	cachePurgeCmd.Flags().BoolVar(&purgeExpired, "expired", false, "delete every expired session")
+	cachePurgeCmd.Flags().BoolVar(&purgeAll, "all", false, "delete every session")
+}
+
+// cacheEntry describes a cached session for the cache list and show
+// commands. The credentials are only set, redacted, by show.
+type cacheEntry struct {
+	Key             string
+	Profile         string
+	AccountId       string
+	RoleName        string
+	AccessKeyID     string `json:",omitempty"`
+	SecretAccessKey string `json:",omitempty"`
+	SessionToken    string `json:",omitempty"`
+	Expiration      string
+	Remaining       string
+	Expired         bool
+	Version         int
+	Metadata        util.SessionMetadata
+}
+
+// newCacheEntry describes the session cached under key.
+func newCacheEntry(key string, awsCreds util.AwsCreds) cacheEntry {
+	entry := cacheEntry{
+		Key:       key,
+		Profile:   awsCreds.Metadata.Profile,
+		AccountId: awsCreds.AccountId,
+		Expired:   !util.ValidateSession(awsCreds),
+		Remaining: "0s",
+		Version:   awsCreds.Version,
+		Metadata:  awsCreds.Metadata,
+	}
+	if roleArn, err := util.ParseIamArn(awsCreds.Metadata.RoleArn, "role"); err == nil {
+		entry.RoleName = roleArn.Name()
+	} else if strings.HasPrefix(key, "role-session-") {
+		// sessions cached without metadata only have the role in the key
+		parts := strings.SplitN(strings.TrimPrefix(key, "role-session-"), "_", 2)
+		if len(parts) == 2 {
+			entry.RoleName = parts[1]
+		}
+	}
+	if awsCreds.Expiration != 0 {
+		expiration := time.Unix(awsCreds.Expiration, 0)
+		entry.Expiration = expiration.Format(time.RFC3339)
+		if !entry.Expired {
+			entry.Remaining = util.Round(expiration.Sub(time.Now()), time.Second).String()
+		}
+	}
+	return entry
+}
+
+// profileCachedSession returns the cached session of a profile from the
+// Profiles or AuthProfiles section and the key it's cached under, or an
+// empty key if there isn't one. Sessions cached by older versions of
+// Portray are found too.
+func profileCachedSession(name string) (string, util.AwsCreds) {
+	var keys []string
+	if viper.IsSet("Profiles." + name) {
+		chain := roleChain(readRoleProfile(name))
+		keys = []string{roleCacheKey(chain, util.AwsCreds{}), legacyRoleCacheKey(chain[len(chain)-1])}
+	} else if viper.IsSet("AuthProfiles." + name) {
+		authProfile := readAuthProfile(name)
+		keys = []string{authCacheKey(authProfile), legacyAuthCacheKey(authProfile)}
+	} else {
+		fmt.Printf("Invalid profile %s! Is it configured in the Profiles or AuthProfiles section?\n", name)
+		os.Exit(1)
+	}
+
+	for _, key := range keys {
+		awsCreds, err := cacheStore.Get(key)
+		util.CheckError(err)
+		if awsCreds.SessionToken != "" {
+			return key, awsCreds
+		}
+	}
+	return "", util.AwsCreds{}
+}
+
+// cacheKeyHash hashes the inputs of a session into a short suffix for its
+// cache key.
+func cacheKeyHash(inputs ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(inputs, "\n")))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// redact hides a secret, keeping only its last visible characters.
+func redact(secret string, visible int) string {
+	if len(secret) <= visible*2 {
+		visible = 0
+	}
+	return strings.Repeat("*", 8) + secret[len(secret)-visible:]
+}
+
+// orDash returns value, or a dash if it's empty, for table output.
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// printJSON prints a value as indented JSON.
+func printJSON(v interface{}) {
+	output, err := json.MarshalIndent(v, "", "  ")
+	util.CheckError(err)
+	fmt.Println(string(output))
+}
+
+// cacheStore is where sessions are cached
+var cacheStore util.CredentialStore
+
+// initCache sets up the session cache from the CacheBackend in the config.
+// The default is plaintext files in ~/.aws/.
+func initCache() {
+	encryption := &util.CacheEncryption{
+		Enabled:    viper.GetBool("EncryptCache"),
+		KeyFile:    viper.GetString("CacheKeyFile"),
+		Passphrase: promptPassphrase,
+	}
+
+	switch backend := viper.GetString("CacheBackend"); backend {
+	case "", "file":
+		cacheStore = &util.FileStore{Dir: cacheDir(), Encryption: encryption}
+	case "encrypted-file":
+		encryption.Enabled = true
+		cacheStore = &util.FileStore{Dir: cacheDir(), Encryption: encryption}
+	case "memory":
+		cacheStore = &util.MemoryStore{}
+	case "pass":
+		cacheStore = &util.CommandStore{Commands: util.PassCommands}
+	case "secret-service":
+		cacheStore = &util.CommandStore{Commands: util.SecretServiceCommands}
+	case "command":
+		var commands util.StoreCommands
+		err := viper.UnmarshalKey("CacheCommands", &commands)
+		util.CheckError(err)
+		cacheStore = &util.CommandStore{Commands: commands}
+	default:
+		fmt.Printf("Unknown CacheBackend %s! Valid values are file, encrypted-file, memory, pass, secret-service and command\n", backend)
+		os.Exit(1)
+	}
+}
+
+// cacheDir returns the directory session files and their locks are kept in.
+// PORTRAY_CACHE_DIR or the CacheDir config key override the default of
+// ~/.aws/.
+func cacheDir() string {
+	if dir := firstSet(os.Getenv("PORTRAY_CACHE_DIR"), viper.GetString("CacheDir")); dir != "" {
+		dir, err := homedir.Expand(dir)
+		util.CheckError(err)
+		return dir
+	}
+
+	home, err := homedir.Dir()
+	util.CheckError(err)
+
+	return filepath.Join(home, ".aws")
+}
+
+// sessionLockPath returns the path of the lock file for a cache key.
+func sessionLockPath(key string) string {
+	return filepath.Join(cacheDir(), "portray-"+key+".lock")
+}
+
+// lockSession takes the lock for a cache key, so only one portray process
+// refreshes a session at a time. Other processes wait for it and then reuse
+// the new session.
+func lockSession(key string) *util.FileLock {
+	dir := cacheDir()
+	err := os.MkdirAll(dir, 0700)
+	util.CheckError(err)
+
+	lock, err := util.LockFile(sessionLockPath(key), func() {
+		fmt.Fprintf(os.Stderr, "Waiting for another portray process to refresh %s\n", key)
+	})
+	util.CheckError(err)
+
+	return lock
+}
+
+// promptPassphrase returns the cache passphrase from PORTRAY_CACHE_PASSPHRASE,
+// or asks the user for it on the terminal.
+func promptPassphrase() string {
+	if passphrase := os.Getenv("PORTRAY_CACHE_PASSPHRASE"); passphrase != "" {
+		return passphrase
+	}
+
+	fmt.Fprint(os.Stderr, "Enter cache passphrase: ")
+	passphrase, err := util.ReadPassword()
+	fmt.Fprintln(os.Stderr)
+	util.CheckError(err)
+
+	return passphrase
+}
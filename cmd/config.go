@@ -23,10 +23,14 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ghodss/yaml"
 	"github.com/go-ini/ini"
+	"github.com/jasonamyers/portray/util"
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -35,27 +39,45 @@ import (
 var sync bool
 var outFile string
 var format string
+var credentialProcessPrefix string
 
 type PortrayConfig struct {
-	AuthProfiles map[string]AwsAuthProfile `json:auth_profiles`
-	Profiles     map[string]AwsRoleProfile `json:profiles`
+	AuthProfiles map[string]AwsAuthProfile
+	Profiles     map[string]AwsRoleProfile
 }
 
 type AwsAuthProfile struct {
-	Name      string `json:name`
-	AccountId string `json:account_id`
-	UserName  string `json:user_name`
-	Region    string `json:region`
-	Output    string `json:output`
+	Name                 string
+	AccountId            string
+	UserName             string
+	Region               string
+	Output               string
+	DurationSeconds      int64             `json:",omitempty"`
+	StsRegionalEndpoints string            `json:",omitempty"`
+	EndpointUrl          string            `json:",omitempty"`
+	MinRemaining         time.Duration     `json:",omitempty"`
+	Env                  map[string]string `json:",omitempty"`
+	AccountAlias         string            `json:",omitempty"`
+	Environment          string            `json:",omitempty"`
+	PromptColor          string            `json:",omitempty"`
 }
 
 type AwsRoleProfile struct {
-	Name          string `json:name`
-	SourceProfile string `json:source_profile`
-	RoleName      string `json:role_name`
-	RoleArn       string `json:role_arn`
-	MfaSerial     string `json:mfa_serial`
-	ExternalId    string `json:external_id`
+	Name                 string
+	SourceProfile        string
+	RoleName             string
+	RoleArn              string
+	MfaSerial            string
+	ExternalId           string
+	DurationSeconds      int64             `json:",omitempty"`
+	Region               string            `json:",omitempty"`
+	StsRegionalEndpoints string            `json:",omitempty"`
+	EndpointUrl          string            `json:",omitempty"`
+	MinRemaining         time.Duration     `json:",omitempty"`
+	Env                  map[string]string `json:",omitempty"`
+	AccountAlias         string            `json:",omitempty"`
+	Environment          string            `json:",omitempty"`
+	PromptColor          string            `json:",omitempty"`
 }
 
 // configCmd represents the sync command
@@ -75,8 +97,23 @@ as well as sync it with the AWS CLI config`,
 	},
 }
 
+// installCredentialProcessCmd represents the config install-credential-process command
+var installCredentialProcessCmd = &cobra.Command{
+	Use:   "install-credential-process [profile...]",
+	Short: "adds credential_process profiles to the AWS CLI config",
+	Long: `The install-credential-process command writes a profile for each of the
+given Portray profiles into ~/.aws/config that gets its credentials from
+"portray credential-process". Without arguments, every configured profile is
+installed. Profiles are named with a prefix so they don't clash with the
+profiles Portray itself reads from the AWS CLI config.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		installCredentialProcess(args)
+	},
+}
+
 func init() {
 	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(installCredentialProcessCmd)
 
 	configCmd.Flags().BoolP("sync", "s", false, "sync Portray config with AWS CLI")
 	configCmd.Flags().StringVarP(&outFile, "out-file", "o", "", "The file to save the config to")
@@ -85,6 +122,8 @@ func init() {
 	viper.BindPFlag("sync", configCmd.Flags().Lookup("sync"))
 	viper.BindPFlag("outFile", configCmd.Flags().Lookup("out-file"))
 	viper.BindPFlag("format", configCmd.Flags().Lookup("format"))
+
+	installCredentialProcessCmd.Flags().StringVar(&credentialProcessPrefix, "prefix", "portray-", "the prefix for the AWS CLI profile names")
 }
 
 func parseAwsConfig() {
@@ -123,6 +162,11 @@ func parseAwsConfig() {
 		sectionHash := cfg.Section(sectionHeader).KeysHash()
 		profileName := strings.Replace(sectionHeader, "profile ", "", 1)
 
+		// skip profiles written by install-credential-process
+		if strings.HasPrefix(sectionHash["credential_process"], "portray ") {
+			continue
+		}
+
 		// Parse out the profiles that don't have a source_profile defined
 		// and assume they're a source profile that has credentials.
 		if sectionHash["source_profile"] == "" {
@@ -131,6 +175,9 @@ func parseAwsConfig() {
 			profile.Name = profileName
 			profile.Region = sectionHash["region"]
 			profile.Output = sectionHash["output"]
+			profile.DurationSeconds = parseDurationSeconds(profileName, sectionHash["duration_seconds"])
+			profile.StsRegionalEndpoints = sectionHash["sts_regional_endpoints"]
+			profile.EndpointUrl = sectionHash["endpoint_url"]
 
 			awsAuthProfiles[profileName] = profile
 		} else {
@@ -138,10 +185,19 @@ func parseAwsConfig() {
 
 			profile.Name = profileName
 			profile.SourceProfile = sectionHash["source_profile"]
-			profile.RoleName = strings.Split(sectionHash["role_arn"], "/")[1]
+			roleArn, err := util.ParseIamArn(sectionHash["role_arn"], "role")
+			if err != nil {
+				fmt.Printf("Error! Bad role_arn for profile %s. %s\n", profileName, err)
+				os.Exit(1)
+			}
+			profile.RoleName = roleArn.Name()
 			profile.RoleArn = sectionHash["role_arn"]
 			profile.MfaSerial = sectionHash["mfa_serial"]
 			profile.ExternalId = sectionHash["external_id"]
+			profile.DurationSeconds = parseDurationSeconds(profileName, sectionHash["duration_seconds"])
+			profile.Region = sectionHash["region"]
+			profile.StsRegionalEndpoints = sectionHash["sts_regional_endpoints"]
+			profile.EndpointUrl = sectionHash["endpoint_url"]
 
 			awsRoleProfiles[profileName] = profile
 		}
@@ -156,15 +212,24 @@ func parseAwsConfig() {
 
 		// See if this profile has any references pointing to it and count them
 		for _, values := range awsRoleProfiles {
-			if values.SourceProfile == profileName {
+			// Role profiles chained from other role profiles, or without an
+			// MFA device, don't tell us anything about the source profile.
+			if values.SourceProfile == profileName && values.MfaSerial != "" {
 				numReferences += 1
 
 				// When we find the first reference, infer account and username
 				// details from it and update the AuthProfiles map.
 				if numReferences == 1 {
-					// grab username from MFA ARN
-					userName := strings.Split(values.MfaSerial, "/")[1]
-					accountId := strings.Split(values.MfaSerial, ":")[4]
+					// grab username and account from MFA ARN
+					mfaArn, err := util.ParseIamArn(values.MfaSerial, "mfa")
+					if err != nil {
+						// hardware MFA devices have serial numbers instead
+						fmt.Printf("Warning! The mfa_serial of %s isn't an ARN, so the AccountId and UserName of %s can't be inferred from it\n", values.Name, profileName)
+						numReferences -= 1
+						continue
+					}
+					userName := mfaArn.Name()
+					accountId := mfaArn.AccountId
 
 					// Create a temp map to update the fields for the auth
 					// profile and copy it back into the awsAuthProfiles map.
@@ -208,6 +273,137 @@ func parseAwsConfig() {
 	}
 }
 
+// parseDurationSeconds parses the duration_seconds of an AWS CLI profile,
+// returning 0 if it isn't set.
+func parseDurationSeconds(profileName string, value string) int64 {
+	if value == "" {
+		return 0
+	}
+
+	durationSeconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		fmt.Printf("Invalid duration_seconds %s for profile %s\n", value, profileName)
+		os.Exit(1)
+	}
+
+	return durationSeconds
+}
+
+func installCredentialProcess(profiles []string) {
+	home, err := homedir.Dir()
+	check(err)
+	configFile := home + "/.aws/config"
+
+	cfg, err := ini.LooseLoad(configFile)
+	check(err)
+
+	// default to every profile in the Portray config
+	if len(profiles) == 0 {
+		profiles = append(profileNames("AuthProfiles"), profileNames("Profiles")...)
+	}
+
+	for _, name := range profiles {
+		if !viper.IsSet("Profiles."+name) && !viper.IsSet("AuthProfiles."+name) {
+			fmt.Printf("Error! Unable to find profile %s in config\n", name)
+			os.Exit(1)
+		}
+
+		sectionName := "profile " + credentialProcessPrefix + name
+		if credentialProcessPrefix+name == "default" {
+			sectionName = "default"
+		}
+
+		section := cfg.Section(sectionName)
+		section.Key("credential_process").SetValue("portray credential-process --profile " + name)
+		if region := profileRegion(name); region != "" {
+			section.Key("region").SetValue(region)
+		}
+
+		fmt.Printf("Added credential_process for %s to [%s]\n", name, sectionName)
+	}
+
+	err = cfg.SaveTo(configFile)
+	check(err)
+}
+
+// profileRegion returns the region of a profile. Role Profiles without one
+// inherit it from their source profile, as in their sessions.
+func profileRegion(name string) string {
+	if viper.IsSet("Profiles." + name) {
+		chain := roleChain(readRoleProfile(name))
+		return chain[len(chain)-1].Region
+	}
+	return viper.GetString("AuthProfiles." + name + ".Region")
+}
+
+// profileNames returns the sorted keys of the profiles in a section of the
+// Portray config, which is how commands name them. Viper lowercases keys, so
+// they're taken from the config file when it can be read.
+func profileNames(section string) []string {
+	var names []string
+	profiles, ok := lookupFold(rawConfig(), section).(map[string]interface{})
+	if ok {
+		for key := range profiles {
+			names = append(names, key)
+		}
+	} else {
+		for key := range viper.GetStringMap(section) {
+			names = append(names, key)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// configEnv returns the Env of a profile with the names as they're written
+// in the config file, since viper lower cases them and environment variables
+// are case sensitive. env, from viper, is returned when the file can't be
+// read.
+func configEnv(section string, name string, env map[string]string) map[string]string {
+	if len(env) == 0 {
+		return env
+	}
+
+	profiles, _ := lookupFold(rawConfig(), section).(map[string]interface{})
+	profile, _ := lookupFold(profiles, name).(map[string]interface{})
+	rawEnv, ok := lookupFold(profile, "Env").(map[string]interface{})
+	if !ok {
+		return env
+	}
+
+	named := make(map[string]string)
+	for key, value := range rawEnv {
+		named[key] = fmt.Sprint(value)
+	}
+	return named
+}
+
+// rawConfig returns the config file as it's written, or nil when it can't be
+// read.
+func rawConfig() map[string]interface{} {
+	data, err := ioutil.ReadFile(viper.ConfigFileUsed())
+	if err != nil {
+		return nil
+	}
+	var config map[string]interface{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil
+	}
+	return config
+}
+
+// lookupFold returns the value of a key in a config map, ignoring case like
+// viper does.
+func lookupFold(m map[string]interface{}, key string) interface{} {
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return nil
+}
+
 func check(e error) {
 	if e != nil {
 		panic(e)
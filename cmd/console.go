@@ -0,0 +1,114 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jasonamyers/portray/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var consoleProfile string
+var consoleTokenCode string
+var consoleNoMfa bool
+var consoleService string
+var consoleDuration time.Duration
+var consolePrint bool
+var consoleFederationUrl string
+
+// consoleCmd represents the console command
+var consoleCmd = &cobra.Command{
+	Use:   "console",
+	Short: "signs in to the AWS console with a session",
+	Long: `The console command signs in to the AWS console with the session of a
+named profile, or the session in the environment if no profile is given, and
+opens it in your browser. Only role sessions can sign in to the console.
+
+Use --service to go straight to a service, either by its console name or one
+of the shortcuts cfn, cw, ddb, logs, r53, secrets and ssm:
+
+  portray console --profile DevAdmin --service s3`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		sessionDuration := consoleDuration
+		if sessionDuration == 0 {
+			sessionDuration = viper.GetDuration("ConsoleSessionDuration")
+		}
+		if sessionDuration != 0 && (sessionDuration < 15*time.Minute || sessionDuration > 12*time.Hour) {
+			fmt.Println("Error! The console session duration must be between 15m and 12h")
+			os.Exit(1)
+		}
+
+		var awsCreds util.AwsCreds
+		var consoleRegion string
+		if consoleProfile != "" {
+			profile := resolveProfile(consoleProfile)
+			if profile.Info.RoleName == "" {
+				fmt.Printf("Error! %s is an AuthProfile. Only role sessions can sign in to the console\n", consoleProfile)
+				os.Exit(1)
+			}
+
+			var err error
+			awsCreds, err = profile.Fetch(sessionOptions{TokenCode: consoleTokenCode, NoMfa: consoleNoMfa || viper.GetBool("NoMfa"), MinRemaining: minRemaining})
+			util.CheckError(err)
+			consoleRegion = profile.Info.Region
+		} else {
+			awsCreds = util.EnvCreds()
+			if awsCreds.SessionToken == "" {
+				fmt.Println("Error! No session found in the environment. Use --profile, or run console in a portray shell")
+				os.Exit(1)
+			}
+			consoleRegion = firstSet(region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"))
+		}
+
+		federationUrl := firstSet(consoleFederationUrl, viper.GetString("FederationUrl"), util.FederationUrl(consoleRegion))
+		signinToken, err := util.GetSigninToken(federationUrl, awsCreds, sessionDuration)
+		if err != nil {
+			fmt.Printf("Error! Unable to get a console sign-in token: %s\n", err)
+			os.Exit(1)
+		}
+		loginUrl := util.ConsoleLoginUrl(federationUrl, signinToken, util.ConsoleUrl(consoleService, consoleRegion))
+
+		if !consolePrint {
+			if err := util.OpenBrowser(loginUrl); err == nil {
+				fmt.Fprintln(os.Stderr, "Opened the console in your browser")
+				return
+			}
+			fmt.Fprintln(os.Stderr, "Unable to open a browser. Open this URL to sign in to the console:")
+		}
+		fmt.Println(loginUrl)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(consoleCmd)
+
+	consoleCmd.Flags().StringVarP(&consoleProfile, "profile", "p", "", "the named profile to use (default the session in the environment)")
+	consoleCmd.Flags().StringVarP(&consoleTokenCode, "token", "t", "", "an MFA token")
+	consoleCmd.Flags().BoolVarP(&consoleNoMfa, "no-mfa", "n", false, "disable MFA")
+	consoleCmd.Flags().StringVarP(&consoleService, "service", "s", "", "the console service to open, e.g. s3 or ec2")
+	consoleCmd.Flags().DurationVar(&consoleDuration, "duration", 0, "how long the console session lasts, from 15m to 12h (default the ConsoleSessionDuration of the config)")
+	consoleCmd.Flags().BoolVar(&consolePrint, "print", false, "print the sign-in URL instead of opening it")
+	consoleCmd.Flags().StringVar(&consoleFederationUrl, "federation-url", "", "the federation endpoint (default the FederationUrl of the config, or that of the partition)")
+}
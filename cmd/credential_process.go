@@ -0,0 +1,61 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jasonamyers/portray/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var processProfile string
+var processTokenCode string
+var processNoMfa bool
+
+// credentialProcessCmd represents the credential-process command
+var credentialProcessCmd = &cobra.Command{
+	Use:   "credential-process",
+	Short: "prints session credentials for an AWS credential_process",
+	Long: `The credential-process command prints the credentials of a named
+profile in the JSON format expected by the credential_process setting of the
+AWS SDKs and CLI. Sessions are cached and refreshed as for auth and switch.
+
+Use "portray config install-credential-process" to add matching profiles to
+the AWS CLI config.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		awsCreds, _ := loadProfileSession(processProfile, sessionOptions{TokenCode: processTokenCode, NoMfa: processNoMfa || viper.GetBool("NoMfa"), MinRemaining: minRemaining})
+
+		output, err := json.Marshal(util.NewProcessCredentials(awsCreds))
+		util.CheckError(err)
+
+		fmt.Println(string(output))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(credentialProcessCmd)
+
+	credentialProcessCmd.Flags().StringVarP(&processProfile, "profile", "p", "", "the named profile to use")
+	credentialProcessCmd.Flags().StringVarP(&processTokenCode, "token", "t", "", "an MFA token")
+	credentialProcessCmd.Flags().BoolVarP(&processNoMfa, "no-mfa", "n", false, "disable MFA")
+}
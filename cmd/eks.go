@@ -0,0 +1,192 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/jasonamyers/portray/util"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var eksProfile string
+var eksCluster string
+var eksTokenCode string
+var eksNoMfa bool
+var eksApiVersion string
+var kubeconfigPath string
+var kubeconfigUser string
+var kubeconfigCommand string
+
+// eksTokenCmd represents the eks-token command
+var eksTokenCmd = &cobra.Command{
+	Use:   "eks-token",
+	Short: "prints an EKS token for kubectl",
+	Long: `The eks-token command prints an ExecCredential with a token for an EKS
+cluster, signed with the session of a named profile, or the session in the
+environment if no profile is given. kubectl runs it as an exec credential
+plugin, which "portray kubeconfig" sets up.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if eksCluster == "" {
+			fmt.Println("Error! Use --cluster to name the EKS cluster")
+			os.Exit(1)
+		}
+
+		var awsCreds util.AwsCreds
+		var endpoint util.StsEndpoint
+		if eksProfile != "" {
+			profile := resolveProfile(eksProfile)
+			var err error
+			awsCreds, err = profile.Fetch(sessionOptions{TokenCode: eksTokenCode, NoMfa: eksNoMfa || viper.GetBool("NoMfa"), MinRemaining: minRemaining})
+			util.CheckError(err)
+			endpoint = profile.Endpoint
+		} else {
+			awsCreds = util.EnvCreds()
+			if awsCreds.AccessKeyID == "" {
+				fmt.Println("Error! No credentials found in the environment. Use --profile, or run eks-token in a portray shell")
+				os.Exit(1)
+			}
+			awsCreds.Expiration = envExpiration(awsCreds)
+			endpoint = profileEndpoint(firstSet(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")), "", "")
+		}
+
+		token, expiration, err := util.EksToken(awsCreds, eksCluster, endpoint)
+		util.CheckError(err)
+
+		output, err := json.Marshal(util.NewExecCredential(token, expiration, eksApiVersion))
+		util.CheckError(err)
+		fmt.Println(string(output))
+	},
+}
+
+// kubeconfigCmd represents the kubeconfig command
+var kubeconfigCmd = &cobra.Command{
+	Use:   "kubeconfig",
+	Short: "adds an EKS user to the kubeconfig",
+	Long: `The kubeconfig command adds a user to the kubeconfig that gets its EKS
+tokens from "portray eks-token", so kubectl goes through the same sessions,
+MFA prompts and role switching as the rest of portray. A user of the same
+name is replaced.
+
+The kubeconfig is the first file in $KUBECONFIG, or ~/.kube/config.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if eksProfile == "" || eksCluster == "" {
+			fmt.Println("Error! Use --profile and --cluster to name the profile and EKS cluster")
+			os.Exit(1)
+		}
+		// check the profile now, rather than when kubectl runs
+		resolveProfile(eksProfile)
+
+		path := kubeconfigPath
+		if path == "" {
+			path = defaultKubeconfig()
+		}
+
+		config := map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Config",
+		}
+		data, err := ioutil.ReadFile(path)
+		if err == nil {
+			err = yaml.Unmarshal(data, &config)
+			util.CheckError(err)
+		} else if !os.IsNotExist(err) {
+			util.CheckError(err)
+		}
+
+		name := kubeconfigUser
+		if name == "" {
+			name = eksProfile + "@" + eksCluster
+		}
+		execArgs := []string{"eks-token", "--profile", eksProfile, "--cluster", eksCluster}
+		if region != "" {
+			execArgs = append(execArgs, "--region", region)
+		}
+		user := map[string]interface{}{
+			"name": name,
+			"user": map[string]interface{}{
+				"exec": map[string]interface{}{
+					"apiVersion": eksApiVersion,
+					"command":    kubeconfigCommand,
+					"args":       execArgs,
+				},
+			},
+		}
+
+		var users []interface{}
+		if existing, ok := config["users"].([]interface{}); ok {
+			for _, u := range existing {
+				if entry, ok := u.(map[string]interface{}); ok && entry["name"] == name {
+					continue
+				}
+				users = append(users, u)
+			}
+		}
+		config["users"] = append(users, user)
+
+		output, err := yaml.Marshal(config)
+		util.CheckError(err)
+		err = os.MkdirAll(filepath.Dir(path), 0700)
+		util.CheckError(err)
+		err = ioutil.WriteFile(path, output, 0600)
+		util.CheckError(err)
+
+		fmt.Printf("Added user %s to %s\n", name, path)
+		fmt.Printf("Use it in a context with: kubectl config set-context <context> --user %s\n", name)
+	},
+}
+
+// defaultKubeconfig returns the kubeconfig kubectl writes to, which is the
+// first file in $KUBECONFIG or ~/.kube/config.
+func defaultKubeconfig() string {
+	if kubeconfig := os.Getenv("KUBECONFIG"); kubeconfig != "" {
+		return strings.Split(kubeconfig, string(os.PathListSeparator))[0]
+	}
+
+	home, err := homedir.Dir()
+	util.CheckError(err)
+	return filepath.Join(home, ".kube", "config")
+}
+
+func init() {
+	rootCmd.AddCommand(eksTokenCmd)
+	rootCmd.AddCommand(kubeconfigCmd)
+
+	for _, cmd := range []*cobra.Command{eksTokenCmd, kubeconfigCmd} {
+		cmd.Flags().StringVarP(&eksProfile, "profile", "p", "", "the named profile to use")
+		cmd.Flags().StringVarP(&eksCluster, "cluster", "c", "", "the name of the EKS cluster")
+		cmd.Flags().StringVar(&eksApiVersion, "api-version", util.ExecCredentialApiVersion, "the client.authentication.k8s.io version of the ExecCredential")
+	}
+	eksTokenCmd.Flags().StringVarP(&eksTokenCode, "token", "t", "", "an MFA token")
+	eksTokenCmd.Flags().BoolVarP(&eksNoMfa, "no-mfa", "n", false, "disable MFA")
+	kubeconfigCmd.Flags().StringVar(&kubeconfigPath, "kubeconfig", "", "the kubeconfig to add the user to (default the first file in $KUBECONFIG, or ~/.kube/config)")
+	kubeconfigCmd.Flags().StringVar(&kubeconfigUser, "user", "", "the name of the user (default <profile>@<cluster>)")
+	kubeconfigCmd.Flags().StringVar(&kubeconfigCommand, "command", "portray", "the portray command kubectl runs")
+}
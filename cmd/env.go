@@ -0,0 +1,63 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jasonamyers/portray/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var envProfile string
+var envTokenCode string
+var envNoMfa bool
+var envFormat string
+
+// envCmd represents the env command
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "prints session credentials as shell statements",
+	Long: `The env command prints the credentials of a named profile so they can
+be loaded into the current shell, instead of starting a new one. For example:
+
+  eval "$(portray env --profile dev)"
+
+Supported formats are bash, zsh, sh, fish, powershell, cmd, dotenv and docker
+(for docker run --env-file).`,
+	Run: func(cmd *cobra.Command, args []string) {
+		awsCreds, info := loadProfileSession(envProfile, sessionOptions{TokenCode: envTokenCode, NoMfa: envNoMfa || viper.GetBool("NoMfa"), MinRemaining: minRemaining})
+
+		output, err := util.FormatEnv(util.SessionEnv(awsCreds, info), envFormat)
+		util.CheckError(err)
+
+		fmt.Print(output)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(envCmd)
+
+	envCmd.Flags().StringVarP(&envProfile, "profile", "p", "", "the named profile to use")
+	envCmd.Flags().StringVarP(&envTokenCode, "token", "t", "", "an MFA token")
+	envCmd.Flags().BoolVarP(&envNoMfa, "no-mfa", "n", false, "disable MFA")
+	envCmd.Flags().StringVarP(&envFormat, "format", "f", "bash", "the output format")
+}
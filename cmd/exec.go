@@ -0,0 +1,60 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/jasonamyers/portray/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var execProfile string
+var execTokenCode string
+var execNoMfa bool
+var execCleanEnv bool
+
+// execCmd represents the exec command
+var execCmd = &cobra.Command{
+	Use:   "exec [flags] -- <command> [args...]",
+	Short: "runs a command with session credentials",
+	Long: `The exec command runs a single command with the credentials of a named
+profile in its environment, instead of starting a new shell. The profile can
+be either a role Profile or an AuthProfile, and the same session cache is used
+as for auth and switch. The exit code of the command is passed through.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		awsCreds, info := loadProfileSession(execProfile, sessionOptions{TokenCode: execTokenCode, NoMfa: execNoMfa || viper.GetBool("NoMfa"), MinRemaining: minRemaining})
+
+		env := sessionEnviron(awsCreds, info, execCleanEnv)
+		os.Exit(util.RunCommand(args[0], args[1:], env))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+
+	execCmd.Flags().SetInterspersed(false)
+	execCmd.Flags().StringVarP(&execProfile, "profile", "p", "", "the named profile to use")
+	execCmd.Flags().StringVarP(&execTokenCode, "token", "t", "", "an MFA token")
+	execCmd.Flags().BoolVarP(&execNoMfa, "no-mfa", "n", false, "disable MFA")
+	execCmd.Flags().BoolVar(&execCleanEnv, "clean-env", false, "run the command with a minimal environment instead of the current one")
+}
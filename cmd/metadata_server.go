@@ -0,0 +1,229 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/jasonamyers/portray/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// defaultMetadataAddress is the address of the instance metadata service
+// on EC2, which SDKs call without any configuration
+const defaultMetadataAddress = "169.254.169.254:80"
+
+// metadataControlPath is where a running metadata server takes requests to
+// swap the profile it serves
+const metadataControlPath = "/portray/profile"
+
+var metadataProfile string
+var metadataTokenCode string
+var metadataNoMfa bool
+var metadataAddress string
+var metadataRequireToken bool
+
+// metadataServerState is written to the cache directory by a running
+// metadata server, so the switch command can find it
+type metadataServerState struct {
+	Address string
+	Token   string
+}
+
+// metadataSwitchRequest asks a running metadata server to serve a profile
+type metadataSwitchRequest struct {
+	Profile string
+}
+
+// metadataServerCmd represents the metadata-server command
+var metadataServerCmd = &cobra.Command{
+	Use:   "metadata-server",
+	Short: "emulates the EC2 instance metadata service",
+	Long: `The metadata-server command emulates the EC2 instance metadata service
+(IMDSv1 and IMDSv2), serving the credentials of a named profile as the
+instance role. Apps and containers that only know the EC2 role provider pick
+up the session, and refreshed sessions, without any configuration.
+
+The server listens on 169.254.169.254:80, or the MetadataAddress set in the
+config, which needs the address to be added to the loopback interface first:
+
+  sudo ip addr add 169.254.169.254/32 dev lo       # Linux
+  sudo ifconfig lo0 alias 169.254.169.254          # macOS
+
+Use "portray metadata-server switch <profile>" to swap the profile served
+without restarting the server or its clients.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		profile := resolveProfile(metadataProfile)
+		load, err := sessionLoader(profile, sessionOptions{TokenCode: metadataTokenCode, NoMfa: metadataNoMfa || viper.GetBool("NoMfa"), MinRemaining: minRemaining})
+		util.CheckError(err)
+
+		handler := util.NewMetadataHandler(profile.Info, load)
+		handler.RequireToken = metadataRequireToken || viper.GetBool("MetadataRequireToken")
+
+		address := firstSet(metadataAddress, viper.GetString("MetadataAddress"), defaultMetadataAddress)
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			fmt.Printf("Error! Unable to listen on %s. %s\n", address, err)
+			if strings.HasPrefix(address, "169.254.169.254:") {
+				fmt.Println("Is 169.254.169.254 added to the loopback interface? See portray metadata-server -h")
+			}
+			os.Exit(1)
+		}
+
+		state := metadataServerState{Address: listener.Addr().String(), Token: randomToken()}
+		statePath := metadataStatePath()
+		data, err := json.Marshal(state)
+		util.CheckError(err)
+		err = ioutil.WriteFile(statePath, data, 0600)
+		util.CheckError(err)
+
+		mux := http.NewServeMux()
+		mux.Handle(metadataControlPath, metadataControlHandler(state.Token, handler))
+		mux.Handle("/", handler)
+		go http.Serve(listener, mux)
+
+		fmt.Fprintf(os.Stderr, "Serving credentials for %s on %s. Press Ctrl-C to stop\n", profile.Info.Profile, state.Address)
+
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+		<-sigs
+		os.Remove(statePath)
+	},
+}
+
+// metadataServerSwitchCmd represents the metadata-server switch command
+var metadataServerSwitchCmd = &cobra.Command{
+	Use:   "switch <profile>",
+	Short: "swaps the profile served by the metadata server",
+	Long: `The switch command makes the running metadata server serve the
+credentials of another named profile. The session is fetched here first, so
+any MFA token is asked for on this terminal. Clients pick up the new
+credentials the next time they refresh theirs.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := ioutil.ReadFile(metadataStatePath())
+		if os.IsNotExist(err) {
+			fmt.Println("Error! No metadata server is running. Start one with portray metadata-server")
+			os.Exit(1)
+		}
+		util.CheckError(err)
+		var state metadataServerState
+		err = json.Unmarshal(data, &state)
+		util.CheckError(err)
+
+		// fetch the session first, so it's in the cache for the server, with
+		// as much time left as the server needs to use it
+		profile := resolveProfile(args[0])
+		_, err = profile.Fetch(serveOptions(profile, sessionOptions{TokenCode: metadataTokenCode, NoMfa: metadataNoMfa || viper.GetBool("NoMfa"), MinRemaining: minRemaining}))
+		util.CheckError(err)
+
+		body, err := json.Marshal(metadataSwitchRequest{Profile: args[0]})
+		util.CheckError(err)
+		req, err := http.NewRequest(http.MethodPost, "http://"+state.Address+metadataControlPath, bytes.NewReader(body))
+		util.CheckError(err)
+		req.Header.Set("Authorization", state.Token)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			fmt.Printf("Error! Unable to reach the metadata server on %s. Is it running? %s\n", state.Address, err)
+			os.Exit(1)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			message, _ := ioutil.ReadAll(resp.Body)
+			fmt.Printf("Error! The metadata server refused to switch to %s. %s\n", args[0], strings.TrimSpace(string(message)))
+			os.Exit(1)
+		}
+
+		fmt.Printf("The metadata server on %s now serves credentials for %s\n", state.Address, args[0])
+	},
+}
+
+// metadataControlHandler takes the requests of the switch command, which
+// must send the token of the server in their Authorization header. The
+// switch command has fetched the session already, so the server never asks
+// for an MFA token, and errors are returned to the switch command instead of
+// stopping the server.
+func metadataControlHandler(token string, handler *util.MetadataHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorized := subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(token)) == 1
+		if r.Method != http.MethodPost || !authorized {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		var request metadataSwitchRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// the profiles were read when the server started
+		if !viper.IsSet("Profiles."+request.Profile) && !viper.IsSet("AuthProfiles."+request.Profile) {
+			http.Error(w, "Unknown profile. Restart the server to pick up new profiles", http.StatusNotFound)
+			return
+		}
+
+		profile, err := lookupProfile(request.Profile)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		load, err := sessionLoader(profile, sessionOptions{NoMfa: metadataNoMfa || viper.GetBool("NoMfa"), MinRemaining: minRemaining, NoPrompt: true})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		handler.SetSession(profile.Info, load)
+		fmt.Fprintf(os.Stderr, "Serving credentials for %s\n", profile.Info.Profile)
+	})
+}
+
+// metadataStatePath returns the path of the file a running metadata server
+// is described in.
+func metadataStatePath() string {
+	dir := cacheDir()
+	err := os.MkdirAll(dir, 0700)
+	util.CheckError(err)
+	return filepath.Join(dir, "portray-metadata-server")
+}
+
+func init() {
+	rootCmd.AddCommand(metadataServerCmd)
+	metadataServerCmd.AddCommand(metadataServerSwitchCmd)
+
+	metadataServerCmd.PersistentFlags().StringVarP(&metadataTokenCode, "token", "t", "", "an MFA token")
+	metadataServerCmd.PersistentFlags().BoolVarP(&metadataNoMfa, "no-mfa", "n", false, "disable MFA")
+	metadataServerCmd.Flags().StringVarP(&metadataProfile, "profile", "p", "", "the named profile to serve")
+	metadataServerCmd.Flags().StringVar(&metadataAddress, "address", "", "the address to listen on (default 169.254.169.254:80 or the MetadataAddress of the config)")
+	metadataServerCmd.Flags().BoolVar(&metadataRequireToken, "imdsv2", false, "only accept IMDSv2 requests, which carry a session token")
+}
@@ -0,0 +1,80 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jasonamyers/portray/util"
+	"github.com/spf13/viper"
+)
+
+func TestMetadataControlHandler(t *testing.T) {
+	loadConfig(t, chainConfig)
+	dir, err := ioutil.TempDir("", "portray-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	viper.Set("CacheDir", dir)
+	defer func(store util.CredentialStore) { cacheStore = store }(cacheStore)
+	cacheStore = &util.MemoryStore{}
+
+	tests := []struct {
+		name          string
+		method        string
+		authorization string
+		body          string
+		wantStatus    int
+	}{
+		{"no token", http.MethodPost, "", `{"Profile":"dev"}`, http.StatusForbidden},
+		{"wrong token", http.MethodPost, "secret-tokem", `{"Profile":"dev"}`, http.StatusForbidden},
+		{"GET", http.MethodGet, "secret-token", `{"Profile":"dev"}`, http.StatusForbidden},
+		{"bad request", http.MethodPost, "secret-token", `{"Profile":`, http.StatusBadRequest},
+		{"unknown profile", http.MethodPost, "secret-token", `{"Profile":"nowhere"}`, http.StatusNotFound},
+		{"broken profile", http.MethodPost, "secret-token", `{"Profile":"Broken"}`, http.StatusBadRequest},
+		{"looping profile", http.MethodPost, "secret-token", `{"Profile":"LoopA"}`, http.StatusBadRequest},
+		{"MFA needed", http.MethodPost, "secret-token", `{"Profile":"dev"}`, http.StatusBadGateway},
+	}
+
+	info := util.SessionInfo{AccountId: "111111111111", Profile: "Admin"}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			served := util.NewMetadataHandler(info, func() (util.AwsCreds, error) { return util.AwsCreds{}, nil })
+			handler := metadataControlHandler("secret-token", served)
+
+			req := httptest.NewRequest(test.method, "/", strings.NewReader(test.body))
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, test.wantStatus, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jasonamyers/portray/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var promptShell string
+var promptTemplate string
+
+// promptCmd represents the prompt command
+var promptCmd = &cobra.Command{
+	Use:   "prompt",
+	Short: "renders the prompt of the current session",
+	Long: `The prompt command renders the PromptTemplate for the session of the
+portray shell it's run in, so shell prompts can show the time the session has
+left. It prints nothing outside of a portray session.
+
+PS1='$(portray prompt --shell bash) \w \$ '`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if os.Getenv("PORTRAY_ACCOUNT") == "" {
+			return
+		}
+
+		info := util.SessionInfo{
+			AccountId: os.Getenv("PORTRAY_ACCOUNT"),
+			RoleName:  os.Getenv("PORTRAY_ROLE"),
+			Profile:   os.Getenv("PORTRAY_PROFILE"),
+			Region:    os.Getenv("AWS_REGION"),
+		}
+		if chain := os.Getenv("PORTRAY_CHAIN"); chain != "" {
+			info.Chain = strings.Split(chain, util.ChainSeparator)
+		}
+
+		// the rest of the prompt comes from the profile in the config
+		var accountAlias, environment, promptColor string
+		if info.Profile != "" && viper.IsSet("Profiles."+info.Profile) {
+			var roleProfile AwsRoleProfile
+			err := viper.UnmarshalKey("Profiles."+info.Profile, &roleProfile)
+			util.CheckError(err)
+			accountAlias, environment, promptColor = roleProfile.AccountAlias, roleProfile.Environment, roleProfile.PromptColor
+		} else if info.Profile != "" && viper.IsSet("AuthProfiles."+info.Profile) {
+			var authProfile AwsAuthProfile
+			err := viper.UnmarshalKey("AuthProfiles."+info.Profile, &authProfile)
+			util.CheckError(err)
+			accountAlias, environment, promptColor = authProfile.AccountAlias, authProfile.Environment, authProfile.PromptColor
+		}
+		info = withPrompt(info, accountAlias, environment, promptColor)
+		if promptTemplate != "" {
+			info.PromptTemplate = promptTemplate
+		}
+
+		expiration, _ := strconv.ParseInt(os.Getenv("PORTRAY_EXPIRATION"), 10, 64)
+		prompt, err := info.RenderPrompt(expiration, promptShell)
+		util.CheckError(err)
+
+		fmt.Println(prompt)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(promptCmd)
+
+	promptCmd.Flags().StringVarP(&promptShell, "shell", "s", "", "bash or zsh, to mark colors as not taking up space in the prompt")
+	promptCmd.Flags().StringVar(&promptTemplate, "template", "", "the template to render (default the PromptTemplate in the config)")
+}
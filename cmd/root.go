@@ -22,6 +22,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
@@ -30,6 +31,10 @@ import (
 
 var cfgFile string
 var debug bool
+var region string
+var stsRegionalEndpoints string
+var endpointUrl string
+var minRemaining time.Duration
 
 // compile time build info
 var (
@@ -61,6 +66,10 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.portray.yaml)")
 	rootCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "enable debug mode for verbose output")
+	rootCmd.PersistentFlags().StringVar(&region, "region", "", "the region to call STS in and export to the session (overrides the profile)")
+	rootCmd.PersistentFlags().StringVar(&stsRegionalEndpoints, "sts-regional-endpoints", "", "legacy or regional (overrides the profile)")
+	rootCmd.PersistentFlags().StringVar(&endpointUrl, "endpoint-url", "", "a custom STS endpoint URL (overrides the profile)")
+	rootCmd.PersistentFlags().DurationVar(&minRemaining, "min-remaining", 0, "refresh cached sessions with less than this left, e.g. 15m (overrides the profile)")
 
 	viper.BindPFlag("config", rootCmd.Flags().Lookup("config"))
 	viper.BindPFlag("debug", rootCmd.Flags().Lookup("debug"))
@@ -92,4 +101,6 @@ func initConfig() {
 	if err := viper.ReadInConfig(); err == nil {
 		//log.Debug().Msg("Found config file %s", viper.ConfigFileUsed()))
 	}
+
+	initCache()
 }
@@ -0,0 +1,162 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/jasonamyers/portray/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// defaultServeMinRemaining is how long a served session must have left
+// before it's refreshed, unless a MinRemaining is set, so that SDKs never
+// receive credentials that are about to expire
+const defaultServeMinRemaining = 15 * time.Minute
+
+var serveProfile string
+var serveTokenCode string
+var serveNoMfa bool
+var serveAddress string
+var servePort int
+var serveFormat string
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve [flags] [-- <command> [args...]]",
+	Short: "serves session credentials to SDKs over HTTP",
+	Long: `The serve command runs a local HTTP endpoint that serves the credentials
+of a named profile with the container credentials protocol, as used on ECS.
+SDKs and the AWS CLI pointed at it with AWS_CONTAINER_CREDENTIALS_FULL_URI and
+AWS_CONTAINER_AUTHORIZATION_TOKEN fetch credentials from it when they need
+them, so long running processes pick up refreshed sessions instead of keeping
+credentials that expire.
+
+Without a command, the variables are printed in the given format and the
+endpoint runs until interrupted:
+
+  portray serve --profile dev --format dotenv > creds.env
+
+With a command, it's run with the variables in its environment and the
+endpoint stops when it exits:
+
+  portray serve --profile dev -- code .
+
+Sessions are cached and refreshed as for auth and switch. Any MFA token is
+asked for when the server starts. Refreshes never prompt for one, so once a
+refresh needs a token, requests fail until a new session is started with MFA,
+e.g. with portray auth.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		profile := resolveProfile(serveProfile)
+		load, err := sessionLoader(profile, sessionOptions{TokenCode: serveTokenCode, NoMfa: serveNoMfa || viper.GetBool("NoMfa"), MinRemaining: minRemaining})
+		util.CheckError(err)
+
+		authToken := randomToken()
+
+		listener, err := net.Listen("tcp", net.JoinHostPort(serveAddress, strconv.Itoa(servePort)))
+		util.CheckError(err)
+		uri := "http://" + listener.Addr().String() + "/"
+		go http.Serve(listener, util.ContainerCredentialsHandler(authToken, load))
+
+		vars := util.ContainerEnv(uri, authToken, profile.Info.Region)
+		if len(args) > 0 {
+			env := util.MergeEnv(os.Environ(), vars)
+			os.Exit(util.RunCommand(args[0], args[1:], env))
+		}
+
+		output, err := util.FormatEnv(vars, serveFormat)
+		util.CheckError(err)
+		fmt.Print(output)
+		fmt.Fprintf(os.Stderr, "Serving credentials for %s on %s. Press Ctrl-C to stop\n", profile.Info.Profile, uri)
+
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+		<-sigs
+	},
+}
+
+// serveOptions returns the options a server loads the session of a profile
+// with. The session is refreshed when it has less than the MinRemaining of
+// the profile left, or 15 minutes by default.
+func serveOptions(profile profileSession, opts sessionOptions) sessionOptions {
+	opts.MinRemaining = opts.minRemaining(profile.MinRemaining)
+	if opts.MinRemaining == 0 {
+		opts.MinRemaining = defaultServeMinRemaining
+	}
+	return opts
+}
+
+// sessionLoader fetches the session of a profile, so any MFA prompt happens
+// up front, and returns a function that returns the session to serve,
+// refreshed as set by serveOptions. Refreshes never prompt for an MFA token,
+// since they happen while serving a request, so they fail instead when a
+// token is needed.
+func sessionLoader(profile profileSession, opts sessionOptions) (func() (util.AwsCreds, error), error) {
+	opts = serveOptions(profile, opts)
+
+	awsCreds, err := profile.Fetch(opts)
+	if err != nil {
+		return nil, err
+	}
+	// the token passed on the command line can only be used once
+	opts.TokenCode = ""
+	opts.NoPrompt = true
+
+	return func() (util.AwsCreds, error) {
+		if !util.ValidateSessionFor(awsCreds, opts.MinRemaining) {
+			creds, err := profile.Fetch(opts)
+			if err != nil {
+				return util.AwsCreds{}, err
+			}
+			awsCreds = creds
+		}
+		return awsCreds, nil
+	}, nil
+}
+
+// randomToken returns a random token to authorize requests to a server.
+func randomToken() string {
+	token := make([]byte, 32)
+	_, err := rand.Read(token)
+	util.CheckError(err)
+	return hex.EncodeToString(token)
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().SetInterspersed(false)
+	serveCmd.Flags().StringVarP(&serveProfile, "profile", "p", "", "the named profile to use")
+	serveCmd.Flags().StringVarP(&serveTokenCode, "token", "t", "", "an MFA token")
+	serveCmd.Flags().BoolVarP(&serveNoMfa, "no-mfa", "n", false, "disable MFA")
+	serveCmd.Flags().StringVar(&serveAddress, "address", "127.0.0.1", "the address to listen on, which SDKs only accept if it's a loopback address")
+	serveCmd.Flags().IntVar(&servePort, "port", 0, "the port to listen on (default a random free port)")
+	serveCmd.Flags().StringVarP(&serveFormat, "format", "f", "bash", "the output format of the variables")
+}
@@ -0,0 +1,106 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jasonamyers/portray/util"
+	"github.com/spf13/viper"
+)
+
+func TestServeOptions(t *testing.T) {
+	viper.Reset()
+
+	tests := []struct {
+		name             string
+		profile          time.Duration
+		flag             time.Duration
+		config           time.Duration
+		wantMinRemaining time.Duration
+	}{
+		{"default", 0, 0, 0, defaultServeMinRemaining},
+		{"profile", 30 * time.Minute, 0, 0, 30 * time.Minute},
+		{"flag", 30 * time.Minute, 5 * time.Minute, 0, 5 * time.Minute},
+		{"config", 0, 0, time.Hour, time.Hour},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Set("MinRemaining", test.config)
+			defer viper.Set("MinRemaining", 0)
+
+			opts := serveOptions(profileSession{MinRemaining: test.profile}, sessionOptions{MinRemaining: test.flag})
+			if opts.MinRemaining != test.wantMinRemaining {
+				t.Errorf("MinRemaining = %v, want %v", opts.MinRemaining, test.wantMinRemaining)
+			}
+		})
+	}
+}
+
+func TestSessionLoader(t *testing.T) {
+	viper.Reset()
+
+	var fetched []sessionOptions
+	expiration := time.Now().Add(time.Hour).Unix()
+	var fetchErr error
+	profile := profileSession{
+		Fetch: func(opts sessionOptions) (util.AwsCreds, error) {
+			fetched = append(fetched, opts)
+			if fetchErr != nil {
+				return util.AwsCreds{}, fetchErr
+			}
+			return util.AwsCreds{AccessKeyID: "ASIAEXAMPLE", SessionToken: "token", Expiration: expiration}, nil
+		},
+	}
+
+	load, err := sessionLoader(profile, sessionOptions{TokenCode: "123456"})
+	if err != nil {
+		t.Fatalf("sessionLoader failed: %s", err)
+	}
+	if len(fetched) != 1 || fetched[0].TokenCode != "123456" || fetched[0].NoPrompt {
+		t.Fatalf("first fetch = %+v, want it with the token and prompting", fetched)
+	}
+
+	// a session with more than MinRemaining left is served as is
+	if _, err := load(); err != nil || len(fetched) != 1 {
+		t.Errorf("load fetched the session again: %+v, %v", fetched, err)
+	}
+
+	// one that's about to expire is refreshed, without the used token or
+	// prompting
+	expiration = time.Now().Add(5 * time.Minute).Unix()
+	load, _ = sessionLoader(profile, sessionOptions{TokenCode: "123456"})
+	fetched = nil
+	load()
+	if len(fetched) != 1 {
+		t.Fatalf("load fetched the session %d times, want once", len(fetched))
+	}
+	if fetched[0].TokenCode != "" || !fetched[0].NoPrompt {
+		t.Errorf("refresh options = %+v, want no token and NoPrompt", fetched[0])
+	}
+
+	fetchErr = errors.New("an MFA token is needed")
+	if _, err := load(); err == nil {
+		t.Error("load succeeded when the refresh failed")
+	}
+}
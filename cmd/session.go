@@ -0,0 +1,693 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/jasonamyers/portray/util"
+	"github.com/spf13/viper"
+)
+
+// sessionOptions holds the command line options that affect how new
+// sessions are started.
+type sessionOptions struct {
+	TokenCode string
+	NoMfa     bool
+
+	// DurationSeconds overrides the session duration of the profile being
+	// loaded, but not of the source profiles it's assumed from.
+	DurationSeconds int64
+
+	// MinRemaining overrides how long a cached session must have left to
+	// be reused instead of refreshed.
+	MinRemaining time.Duration
+
+	// SourceCreds, when set, is used to assume the first role of a chain
+	// instead of the session of its source profile.
+	SourceCreds util.AwsCreds
+
+	// Source is set when loading a session to assume a role with. Source
+	// sessions are reused while they're valid at all, since the role
+	// session doesn't expire with them, so the user isn't prompted for an
+	// MFA token just to refresh a role.
+	Source bool
+
+	// NoPrompt is set where the user can't be asked for an MFA token, such
+	// as when a server refreshes a session. Sessions that need a token
+	// fail instead.
+	NoPrompt bool
+}
+
+// sourceOptions returns the options used to load the source session of a
+// profile.
+func (opts sessionOptions) sourceOptions() sessionOptions {
+	opts.DurationSeconds = 0
+	opts.MinRemaining = 0
+	opts.Source = true
+	return opts
+}
+
+// minRemaining returns how long a cached session of a profile must have
+// left to be reused. The --min-remaining flag overrides the MinRemaining of
+// the profile, which overrides the top level MinRemaining of the config.
+func (opts sessionOptions) minRemaining(profileMinRemaining time.Duration) time.Duration {
+	if opts.Source {
+		return 0
+	}
+	if opts.MinRemaining != 0 {
+		return opts.MinRemaining
+	}
+	if profileMinRemaining != 0 {
+		return profileMinRemaining
+	}
+	return viper.GetDuration("MinRemaining")
+}
+
+// reuseSession reports whether a cached session can be reused, telling the
+// user when a valid session is refreshed because it's about to expire.
+func reuseSession(awsCreds util.AwsCreds, minRemaining time.Duration) bool {
+	if awsCreds.SessionToken == "" || !util.ValidateSession(awsCreds) {
+		return false
+	}
+	if !util.ValidateSessionFor(awsCreds, minRemaining) {
+		timeLeft := time.Unix(awsCreds.Expiration, 0).Sub(time.Now())
+		fmt.Fprintf(os.Stderr, "Cached session expires in %v, less than the minimum of %v. Refreshing it\n",
+			util.Round(timeLeft, time.Second), minRemaining)
+		return false
+	}
+	return true
+}
+
+// readAuthProfile looks up a configured AuthProfile, exiting if it's missing
+// or incomplete.
+func readAuthProfile(name string) AwsAuthProfile {
+	authProfile, err := lookupAuthProfile(name)
+	exitOnProfileError(err)
+	return authProfile
+}
+
+// lookupAuthProfile is readAuthProfile, returning the error instead of
+// exiting.
+func lookupAuthProfile(name string) (authProfile AwsAuthProfile, err error) {
+	if !viper.IsSet("AuthProfiles." + name) {
+		return authProfile, fmt.Errorf("Invalid profile %s! Is it configured in the AuthProfiles section?", name)
+	}
+	if err := viper.UnmarshalKey("AuthProfiles."+name, &authProfile); err != nil {
+		return authProfile, err
+	}
+	// the Name is the AWS profile the session is started with
+	if authProfile.Name == "" {
+		authProfile.Name = name
+	}
+	authProfile.Env = configEnv("AuthProfiles", name, authProfile.Env)
+
+	if authProfile.AccountId == "" {
+		return authProfile, fmt.Errorf("Unable to find AccountId for the %s profile. Is it configured in the AuthProfiles section?", name)
+	}
+
+	if authProfile.UserName == "" {
+		return authProfile, fmt.Errorf("Unable to find UserName for the %s profile. Is it configured in the AuthProfiles section?", name)
+	}
+
+	return authProfile, nil
+}
+
+// readRoleProfile looks up a configured role Profile, exiting if it's
+// missing or has a bad RoleArn.
+func readRoleProfile(name string) AwsRoleProfile {
+	roleProfile, err := lookupRoleProfile(name)
+	exitOnProfileError(err)
+	return roleProfile
+}
+
+// lookupRoleProfile is readRoleProfile, returning the error instead of
+// exiting.
+func lookupRoleProfile(name string) (roleProfile AwsRoleProfile, err error) {
+	if !viper.IsSet("Profiles." + name) {
+		return roleProfile, fmt.Errorf("Unable to find profile %s in config. Is it set in the Profiles section?", name)
+	}
+	if err := viper.UnmarshalKey("Profiles."+name, &roleProfile); err != nil {
+		return roleProfile, err
+	}
+	roleProfile.Name = name
+	roleProfile.Env = configEnv("Profiles", name, roleProfile.Env)
+
+	if roleProfile.RoleArn == "" {
+		return roleProfile, errors.New("Couldn't find RoleArn in profile config")
+	}
+	roleArn, err := util.ParseIamArn(roleProfile.RoleArn, "role")
+	if err != nil {
+		return roleProfile, fmt.Errorf("Bad RoleArn for the %s profile. %s", name, err)
+	}
+	// get role name, without its path, from role arn
+	roleProfile.RoleName = roleArn.Name()
+
+	return roleProfile, nil
+}
+
+// exitOnProfileError exits if a profile couldn't be looked up.
+func exitOnProfileError(err error) {
+	if err != nil {
+		fmt.Printf("Error! %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// roleArnAccountId gets the account id from the role arn of a profile, which
+// has already been validated by readRoleProfile or the switch command.
+func roleArnAccountId(roleProfile AwsRoleProfile) string {
+	roleArn, _ := util.ParseIamArn(roleProfile.RoleArn, "role")
+	return roleArn.AccountId
+}
+
+// profileEndpoint returns where STS is called for a profile. The --region,
+// --sts-regional-endpoints and --endpoint-url flags, or the PORTRAY_REGION,
+// AWS_STS_REGIONAL_ENDPOINTS and PORTRAY_ENDPOINT_URL environment variables,
+// override the profile's settings.
+func profileEndpoint(profileRegion string, profileRegionalEndpoints string, profileEndpointUrl string) util.StsEndpoint {
+	return util.StsEndpoint{
+		Region:            firstSet(region, os.Getenv("PORTRAY_REGION"), profileRegion),
+		RegionalEndpoints: firstSet(stsRegionalEndpoints, os.Getenv("AWS_STS_REGIONAL_ENDPOINTS"), profileRegionalEndpoints),
+		EndpointUrl:       firstSet(endpointUrl, os.Getenv("PORTRAY_ENDPOINT_URL"), profileEndpointUrl),
+	}
+}
+
+// roleEndpoint returns where STS is called for a role profile. Without a
+// region, it's called in the partition of the role.
+func roleEndpoint(roleProfile AwsRoleProfile) util.StsEndpoint {
+	endpoint := profileEndpoint(roleProfile.Region, roleProfile.StsRegionalEndpoints, roleProfile.EndpointUrl)
+	roleArn, _ := util.ParseIamArn(roleProfile.RoleArn, "role")
+	endpoint.Partition = roleArn.Partition
+	return endpoint
+}
+
+// profileEnv returns the Env of a profile to set in its sessions, with
+// environment variables in the values expanded.
+func profileEnv(env map[string]string) map[string]string {
+	expanded := make(map[string]string)
+	for name, value := range env {
+		expanded[name] = os.ExpandEnv(value)
+	}
+	return expanded
+}
+
+// withPrompt adds what's shown in the prompt of a session to its info. The
+// account alias of a profile overrides the one in AccountAliases.
+func withPrompt(info util.SessionInfo, accountAlias string, environment string, promptColor string) util.SessionInfo {
+	info, err := lookupPrompt(info, accountAlias, environment, promptColor)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return info
+}
+
+// lookupPrompt is withPrompt, returning the error instead of exiting if the
+// PromptTemplate or PromptColor is invalid.
+func lookupPrompt(info util.SessionInfo, accountAlias string, environment string, promptColor string) (util.SessionInfo, error) {
+	info.AccountAlias = firstSet(accountAlias, viper.GetString("AccountAliases."+info.AccountId))
+	info.Environment = environment
+	info.PromptColor = promptColor
+	info.PromptTemplate = viper.GetString("PromptTemplate")
+
+	return info, util.ValidatePrompt(info.PromptTemplate, info.PromptColor)
+}
+
+// firstSet returns the first of values that isn't empty.
+func firstSet(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// authCacheKey returns the key the session of an AuthProfile is cached
+// under. It's derived from everything that affects the session, so profiles
+// with the same name in different configs don't share a session. The MFA
+// device is that of the UserName.
+func authCacheKey(authProfile AwsAuthProfile) string {
+	endpoint := profileEndpoint(authProfile.Region, authProfile.StsRegionalEndpoints, authProfile.EndpointUrl)
+	return "session-" + authProfile.Name + "-" + cacheKeyHash(
+		authProfile.Name,
+		authProfile.AccountId,
+		authProfile.UserName,
+		endpoint.Region,
+		endpoint.EndpointUrl)
+}
+
+// legacyAuthCacheKey returns the key older versions of Portray cached the
+// session of an AuthProfile under.
+func legacyAuthCacheKey(authProfile AwsAuthProfile) string {
+	return "session-" + authProfile.Name
+}
+
+// roleCacheKey returns the key the session of the last role of a chain is
+// cached under. It's derived from the role, its external id and the session
+// it's assumed with, so roles assumed from different source profiles don't
+// share a session. sourceCreds is the SourceCreds of the sessionOptions.
+func roleCacheKey(chain []AwsRoleProfile, sourceCreds util.AwsCreds) string {
+	roleProfile := chain[len(chain)-1]
+
+	var source string
+	if len(chain) > 1 {
+		source = roleCacheKey(chain[:len(chain)-1], sourceCreds)
+	} else if sourceCreds.AccessKeyID != "" {
+		source = "credentials " + sourceCreds.AccessKeyID
+	} else if viper.IsSet("AuthProfiles." + roleProfile.SourceProfile) {
+		source = authCacheKey(readAuthProfile(roleProfile.SourceProfile))
+	} else {
+		source = roleProfile.SourceProfile + " " + roleProfile.MfaSerial
+	}
+
+	// AssumeRole is passed the user name when there's no external id
+	externalId := roleProfile.ExternalId
+	if externalId == "" {
+		currentUser, err := user.Current()
+		util.CheckError(err)
+		externalId = currentUser.Username
+	}
+
+	endpoint := roleEndpoint(roleProfile)
+	return legacyRoleCacheKey(roleProfile) + "-" + cacheKeyHash(
+		roleProfile.RoleArn,
+		externalId,
+		source,
+		endpoint.EndpointUrl)
+}
+
+// legacyRoleCacheKey returns the key older versions of Portray cached the
+// session of a role Profile under.
+func legacyRoleCacheKey(roleProfile AwsRoleProfile) string {
+	return "role-session-" + roleArnAccountId(roleProfile) + "_" + roleProfile.RoleName
+}
+
+// cachedSession returns the session cached under key. A session cached
+// under legacyKey by an older version of Portray is moved to key first,
+// with the metadata it was cached without. Whether it was started with MFA
+// isn't known.
+func cachedSession(key string, legacyKey string, metadata util.SessionMetadata) util.AwsCreds {
+	awsCreds, err := cacheStore.Get(key)
+	util.CheckError(err)
+	if awsCreds.SessionToken != "" {
+		return awsCreds
+	}
+
+	legacyCreds, err := cacheStore.Get(legacyKey)
+	util.CheckError(err)
+	if legacyCreds.SessionToken == "" || legacyCreds.Version >= util.CacheVersion {
+		return awsCreds
+	}
+
+	legacyCreds.Version = util.CacheVersion
+	legacyCreds.Metadata = metadata
+	legacyCreds.Metadata.MfaUnknown = true
+	err = cacheStore.Put(key, legacyCreds)
+	util.CheckError(err)
+	err = cacheStore.Delete(legacyKey)
+	util.CheckError(err)
+
+	return legacyCreds
+}
+
+// loadAuthSession returns the cached session for an AuthProfile, starting a
+// new STS session when there is no valid cache. The user is prompted for an
+// MFA token if one isn't passed, unless NoMfa is set.
+func loadAuthSession(authProfile AwsAuthProfile, opts sessionOptions) util.AwsCreds {
+	awsCreds, err := fetchAuthSession(authProfile, opts)
+	util.CheckError(err)
+	return awsCreds
+}
+
+// fetchAuthSession is loadAuthSession, returning the error instead of
+// exiting if STS fails to start a session, for callers that can't exit.
+func fetchAuthSession(authProfile AwsAuthProfile, opts sessionOptions) (util.AwsCreds, error) {
+	cacheKey := authCacheKey(authProfile)
+	lock := lockSession(cacheKey)
+	defer lock.Unlock()
+
+	awsCreds := cachedSession(cacheKey, legacyAuthCacheKey(authProfile), util.SessionMetadata{
+		Profile: authProfile.Name,
+	})
+
+	// If there's no valid session cache, generate a new session. Prompt
+	// for MFA token if it's not passed, unless the --no-mfa flag is set.
+	// A session started with --no-mfa isn't reused when MFA is wanted.
+	if missingMfa(awsCreds, opts) || !reuseSession(awsCreds, opts.minRemaining(authProfile.MinRemaining)) {
+		tokenCode := opts.TokenCode
+		if tokenCode == "" {
+			if opts.NoMfa {
+				fmt.Fprintln(os.Stderr, "Skipping MFA token prompting")
+			} else if opts.NoPrompt {
+				return util.AwsCreds{}, fmt.Errorf("an MFA token is needed to start a new session for %s", authProfile.Name)
+			} else {
+				tokenCode = promptToken()
+			}
+		}
+
+		durationSeconds := authProfile.DurationSeconds
+		if opts.DurationSeconds != 0 {
+			durationSeconds = opts.DurationSeconds
+		}
+
+		endpoint := profileEndpoint(authProfile.Region, authProfile.StsRegionalEndpoints, authProfile.EndpointUrl)
+
+		var err error
+		awsCreds, err = util.GetSessionToken(authProfile.Name, authProfile.AccountId, authProfile.UserName, tokenCode, durationSeconds, endpoint)
+		if err != nil {
+			return util.AwsCreds{}, err
+		}
+		err = cacheStore.Put(cacheKey, awsCreds)
+		util.CheckError(err)
+	} else {
+		// Found a cached sessions that's still valid
+		fmt.Fprintln(os.Stderr, "Using cached session credentials")
+		printTimeLeft(awsCreds)
+	}
+
+	return awsCreds, nil
+}
+
+// missingMfa reports whether the cached session of an AuthProfile was started
+// without MFA when opts want it.
+func missingMfa(awsCreds util.AwsCreds, opts sessionOptions) bool {
+	return !usedMfa(awsCreds) && !opts.NoMfa
+}
+
+// usedMfa tells if a session was started with MFA, taking sessions that
+// don't tell as having been.
+func usedMfa(awsCreds util.AwsCreds) bool {
+	return awsCreds.Metadata.MfaUsed || awsCreds.Metadata.MfaUnknown
+}
+
+// roleChain follows the SourceProfile of a role Profile through any other
+// role Profiles it points at, returning the roles to assume in order and
+// ending with roleProfile itself. The first role's SourceProfile, if any, is
+// an AuthProfile or a profile unknown to Portray.
+func roleChain(roleProfile AwsRoleProfile) []AwsRoleProfile {
+	chain, err := lookupRoleChain(roleProfile)
+	exitOnProfileError(err)
+	return chain
+}
+
+// lookupRoleChain is roleChain, returning the error instead of exiting if
+// a profile in the chain is missing or incomplete, or the chain loops.
+func lookupRoleChain(roleProfile AwsRoleProfile) ([]AwsRoleProfile, error) {
+	chain := []AwsRoleProfile{roleProfile}
+	seen := map[string]bool{strings.ToLower(roleProfile.Name): true}
+
+	for chain[0].SourceProfile != "" && viper.IsSet("Profiles."+chain[0].SourceProfile) {
+		source := chain[0].SourceProfile
+		if seen[strings.ToLower(source)] {
+			return nil, fmt.Errorf("The SourceProfile of %s loops back to %s", chain[0].Name, source)
+		}
+		seen[strings.ToLower(source)] = true
+
+		sourceProfile, err := lookupRoleProfile(source)
+		if err != nil {
+			return nil, err
+		}
+		chain = append([]AwsRoleProfile{sourceProfile}, chain...)
+	}
+
+	// Roles without region settings of their own inherit them from the
+	// profile they're assumed from.
+	var source AwsRoleProfile
+	if viper.IsSet("AuthProfiles." + chain[0].SourceProfile) {
+		authProfile, err := lookupAuthProfile(chain[0].SourceProfile)
+		if err != nil {
+			return nil, err
+		}
+		source.Region = authProfile.Region
+		source.StsRegionalEndpoints = authProfile.StsRegionalEndpoints
+		source.EndpointUrl = authProfile.EndpointUrl
+	}
+	for i := range chain {
+		chain[i].Region = firstSet(chain[i].Region, source.Region)
+		chain[i].StsRegionalEndpoints = firstSet(chain[i].StsRegionalEndpoints, source.StsRegionalEndpoints)
+		chain[i].EndpointUrl = firstSet(chain[i].EndpointUrl, source.EndpointUrl)
+		source = chain[i]
+	}
+
+	return chain, nil
+}
+
+// chainPath describes each role in a chain as account:role.
+func chainPath(chain []AwsRoleProfile) []string {
+	var path []string
+	for _, roleProfile := range chain {
+		path = append(path, roleArnAccountId(roleProfile)+":"+roleProfile.RoleName)
+	}
+	return path
+}
+
+// loadRoleSession returns the cached session for the last role of a chain,
+// assuming it via STS when there is no valid cache. Each role is assumed
+// with the session of the role before it, loaded the same way, so every hop
+// is cached separately. The first role is assumed with the MFA session of
+// its SourceProfile when that's an AuthProfile, or with the credentials of the
+// AWS CLI profile of that name otherwise. Without a source session started
+// with MFA, the MfaSerial of the profile, if any, is used to pass an MFA
+// token to AssumeRole.
+func loadRoleSession(chain []AwsRoleProfile, opts sessionOptions) util.AwsCreds {
+	awsCreds, err := fetchRoleSession(chain, opts)
+	util.CheckError(err)
+	return awsCreds
+}
+
+// fetchRoleSession is loadRoleSession, returning the error instead of
+// exiting if STS fails to assume a role, for callers that can't exit.
+func fetchRoleSession(chain []AwsRoleProfile, opts sessionOptions) (util.AwsCreds, error) {
+	currentUser, err := user.Current()
+	util.CheckError(err)
+
+	roleProfile := chain[len(chain)-1]
+	accountId := roleArnAccountId(roleProfile)
+
+	cacheKey := roleCacheKey(chain, opts.SourceCreds)
+	lock := lockSession(cacheKey)
+	defer lock.Unlock()
+
+	awsCreds := cachedSession(cacheKey, legacyRoleCacheKey(roleProfile), util.SessionMetadata{
+		Profile:       roleProfile.Name,
+		SourceProfile: roleProfile.SourceProfile,
+		RoleArn:       roleProfile.RoleArn,
+		ExternalId:    roleProfile.ExternalId,
+	})
+
+	// If there's no valid session cache, generate a new session.
+	if !reuseSession(awsCreds, opts.minRemaining(roleProfile.MinRemaining)) {
+		input := util.RoleSessionInput{
+			RoleArn:         roleProfile.RoleArn,
+			ExternalId:      roleProfile.ExternalId,
+			DurationSeconds: roleProfile.DurationSeconds,
+			Endpoint:        roleEndpoint(roleProfile),
+		}
+		if opts.DurationSeconds != 0 {
+			input.DurationSeconds = opts.DurationSeconds
+		}
+
+		// STS limits sessions of roles assumed from other roles to an hour
+		if len(chain) > 1 && input.DurationSeconds > util.ChainedRoleSessionDuration {
+			fmt.Fprintln(os.Stderr, "Role chain sessions are limited to 1h0m0s")
+			input.DurationSeconds = util.ChainedRoleSessionDuration
+		}
+
+		// Prefer the session of the source profile. Without one, or if it
+		// was started without MFA, pass the MFA token to AssumeRole directly
+		// if the role has an MFA device.
+		needMfa := false
+		if len(chain) > 1 {
+			fmt.Fprintf(os.Stderr, "Using source profile %s\n", roleProfile.SourceProfile)
+			input.SourceCreds, err = fetchRoleSession(chain[:len(chain)-1], opts.sourceOptions())
+			if err != nil {
+				return util.AwsCreds{}, err
+			}
+			needMfa = !usedMfa(input.SourceCreds)
+		} else if opts.SourceCreds.SessionToken != "" {
+			fmt.Fprintln(os.Stderr, "Using the session of the current portray shell")
+			input.SourceCreds = opts.SourceCreds
+		} else if viper.IsSet("AuthProfiles." + roleProfile.SourceProfile) {
+			fmt.Fprintf(os.Stderr, "Using source profile %s\n", roleProfile.SourceProfile)
+			input.SourceCreds, err = fetchAuthSession(readAuthProfile(roleProfile.SourceProfile), opts.sourceOptions())
+			if err != nil {
+				return util.AwsCreds{}, err
+			}
+			needMfa = !usedMfa(input.SourceCreds)
+		} else {
+			// a SourceProfile that isn't in the Portray config is an AWS
+			// CLI profile
+			if roleProfile.SourceProfile != "" {
+				fmt.Fprintf(os.Stderr, "Using AWS CLI profile %s\n", roleProfile.SourceProfile)
+				input.SourceProfile = roleProfile.SourceProfile
+			}
+			needMfa = true
+		}
+		if needMfa && roleProfile.MfaSerial != "" && !opts.NoMfa {
+			input.MfaSerial = roleProfile.MfaSerial
+			input.TokenCode = opts.TokenCode
+			if input.TokenCode == "" && opts.NoPrompt {
+				return util.AwsCreds{}, fmt.Errorf("an MFA token is needed to assume %s", roleProfile.RoleArn)
+			} else if input.TokenCode == "" {
+				input.TokenCode = promptToken()
+			}
+		}
+
+		fmt.Fprintf(os.Stderr, "No session cache found or cache expired. Assuming role %s in account %s\n", roleProfile.RoleName, accountId)
+
+		awsCreds, err = util.AssumeRole(input, *currentUser)
+		if err != nil {
+			return util.AwsCreds{}, err
+		}
+		awsCreds.Metadata.Profile = roleProfile.Name
+		awsCreds.Metadata.SourceProfile = roleProfile.SourceProfile
+
+		err = cacheStore.Put(cacheKey, awsCreds)
+		util.CheckError(err)
+	} else {
+		// Found a cached sessions that's still valid
+		fmt.Fprintln(os.Stderr, "Using cached session credentials")
+		printTimeLeft(awsCreds)
+	}
+
+	return awsCreds, nil
+}
+
+// profileSession is a named profile resolved against the config, whose
+// session can be fetched as often as needed.
+type profileSession struct {
+	Info util.SessionInfo
+
+	// MinRemaining is the MinRemaining of the profile
+	MinRemaining time.Duration
+
+	// Endpoint is where STS is called for the profile
+	Endpoint util.StsEndpoint
+
+	// Fetch returns the session of the profile, refreshing it if needed,
+	// or the error if STS fails.
+	Fetch func(opts sessionOptions) (util.AwsCreds, error)
+}
+
+// resolveProfile resolves a named profile against the Profiles section and
+// then the AuthProfiles section, along with the details used for the
+// prompt. An empty name uses the default AuthProfile.
+func resolveProfile(name string) profileSession {
+	profile, err := lookupProfile(name)
+	exitOnProfileError(err)
+	return profile
+}
+
+// lookupProfile is resolveProfile, returning the error instead of exiting if
+// the profile, or one it's assumed from, is missing or invalid.
+func lookupProfile(name string) (profileSession, error) {
+	if name == "" {
+		name = "default"
+	}
+
+	if viper.IsSet("Profiles." + name) {
+		roleProfile, err := lookupRoleProfile(name)
+		if err != nil {
+			return profileSession{}, err
+		}
+		chain, err := lookupRoleChain(roleProfile)
+		if err != nil {
+			return profileSession{}, err
+		}
+		roleProfile = chain[len(chain)-1]
+		info := util.SessionInfo{
+			AccountId: roleArnAccountId(roleProfile),
+			RoleName:  roleProfile.RoleName,
+			Profile:   name,
+			Region:    profileEndpoint(roleProfile.Region, "", "").Region,
+			Env:       profileEnv(roleProfile.Env),
+			Chain:     chainPath(chain),
+		}
+		info, err = lookupPrompt(info, roleProfile.AccountAlias, roleProfile.Environment, roleProfile.PromptColor)
+		if err != nil {
+			return profileSession{}, err
+		}
+		return profileSession{
+			Info:         info,
+			MinRemaining: roleProfile.MinRemaining,
+			Endpoint:     roleEndpoint(roleProfile),
+			Fetch: func(opts sessionOptions) (util.AwsCreds, error) {
+				return fetchRoleSession(chain, opts)
+			},
+		}, nil
+	}
+
+	authProfile, err := lookupAuthProfile(name)
+	if err != nil {
+		return profileSession{}, err
+	}
+	info := util.SessionInfo{
+		AccountId: authProfile.AccountId,
+		Profile:   name,
+		Region:    profileEndpoint(authProfile.Region, "", "").Region,
+		Env:       profileEnv(authProfile.Env),
+	}
+	info, err = lookupPrompt(info, authProfile.AccountAlias, authProfile.Environment, authProfile.PromptColor)
+	if err != nil {
+		return profileSession{}, err
+	}
+	return profileSession{
+		Info:         info,
+		MinRemaining: authProfile.MinRemaining,
+		Endpoint:     profileEndpoint(authProfile.Region, authProfile.StsRegionalEndpoints, authProfile.EndpointUrl),
+		Fetch: func(opts sessionOptions) (util.AwsCreds, error) {
+			return fetchAuthSession(authProfile, opts)
+		},
+	}, nil
+}
+
+// loadProfileSession returns the session of a named profile, resolved with
+// resolveProfile, along with the details used for the prompt.
+func loadProfileSession(name string, opts sessionOptions) (util.AwsCreds, util.SessionInfo) {
+	profile := resolveProfile(name)
+	awsCreds, err := profile.Fetch(opts)
+	util.CheckError(err)
+	return awsCreds, profile.Info
+}
+
+// promptToken asks the user for an MFA token on the terminal. The prompt is
+// written to stderr so it doesn't end up in captured output.
+func promptToken() string {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Fprint(os.Stderr, "Enter token: ")
+	token, _ := reader.ReadString('\n')
+	return strings.TrimSpace(token)
+}
+
+// printTimeLeft tells the user how much time is left on a session.
+func printTimeLeft(awsCreds util.AwsCreds) {
+	sessionExpiration := time.Unix(awsCreds.Expiration, 0)
+	sessionTimeLeft := sessionExpiration.Sub(time.Now())
+
+	fmt.Fprintf(os.Stderr, "Session valid for %+v\n", util.Round(sessionTimeLeft, time.Second))
+}
@@ -0,0 +1,253 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jasonamyers/portray/util"
+	"github.com/spf13/viper"
+)
+
+// loadConfig makes viper read a Portray config from a string.
+func loadConfig(t *testing.T, config string) {
+	viper.Reset()
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(strings.NewReader(config)); err != nil {
+		t.Fatalf("Unable to read config: %s", err)
+	}
+}
+
+const chainConfig = `
+AuthProfiles:
+  dev:
+    AccountId: "111111111111"
+    UserName: user.name
+    Region: eu-west-1
+Profiles:
+  Admin:
+    RoleArn: arn:aws:iam::222222222222:role/Admin
+    SourceProfile: dev
+  Deploy:
+    RoleArn: arn:aws:iam::333333333333:role/ci/Deploy
+    SourceProfile: Admin
+    Region: us-west-2
+  Release:
+    RoleArn: arn:aws:iam::444444444444:role/Release
+    SourceProfile: deploy
+  LoopA:
+    RoleArn: arn:aws:iam::555555555555:role/A
+    SourceProfile: LoopB
+  LoopB:
+    RoleArn: arn:aws:iam::555555555555:role/B
+    SourceProfile: LoopA
+  Self:
+    RoleArn: arn:aws:iam::555555555555:role/Self
+    SourceProfile: self
+  Broken:
+    RoleArn: arn:aws:iam::555555555555:role/Broken
+    SourceProfile: Missing
+  Missing:
+    SourceProfile: dev
+`
+
+func TestLookupRoleChain(t *testing.T) {
+	loadConfig(t, chainConfig)
+
+	tests := []struct {
+		profile string
+		path    []string
+		regions []string
+	}{
+		{"Admin", []string{"222222222222:Admin"}, []string{"eu-west-1"}},
+		{"Deploy", []string{"222222222222:Admin", "333333333333:Deploy"}, []string{"eu-west-1", "us-west-2"}},
+		{"Release", []string{"222222222222:Admin", "333333333333:Deploy", "444444444444:Release"}, []string{"eu-west-1", "us-west-2", "us-west-2"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.profile, func(t *testing.T) {
+			roleProfile, err := lookupRoleProfile(test.profile)
+			if err != nil {
+				t.Fatalf("lookupRoleProfile failed: %s", err)
+			}
+			chain, err := lookupRoleChain(roleProfile)
+			if err != nil {
+				t.Fatalf("lookupRoleChain failed: %s", err)
+			}
+			if got := strings.Join(chainPath(chain), ","); got != strings.Join(test.path, ",") {
+				t.Errorf("chain = %s, want %s", got, strings.Join(test.path, ","))
+			}
+			for i, roleProfile := range chain {
+				if i < len(test.regions) && roleProfile.Region != test.regions[i] {
+					t.Errorf("Region of %s = %q, want %q", roleProfile.Name, roleProfile.Region, test.regions[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLookupRoleChainErrors(t *testing.T) {
+	loadConfig(t, chainConfig)
+
+	tests := []struct {
+		profile string
+		want    string
+	}{
+		{"LoopA", "loops back"},
+		{"LoopB", "loops back"},
+		{"Self", "loops back"},
+		{"Broken", "RoleArn"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.profile, func(t *testing.T) {
+			roleProfile, err := lookupRoleProfile(test.profile)
+			if err != nil {
+				t.Fatalf("lookupRoleProfile failed: %s", err)
+			}
+			_, err = lookupRoleChain(roleProfile)
+			if err == nil {
+				t.Fatal("lookupRoleChain succeeded, want an error")
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Errorf("lookupRoleChain error = %q, want it to mention %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestAuthCacheKey(t *testing.T) {
+	os.Unsetenv("PORTRAY_REGION")
+	os.Unsetenv("PORTRAY_ENDPOINT_URL")
+	dev := AwsAuthProfile{Name: "dev", AccountId: "111111111111", UserName: "user.name", Region: "eu-west-1"}
+	key := authCacheKey(dev)
+
+	if !strings.HasPrefix(key, "session-dev-") {
+		t.Errorf("authCacheKey = %q, want a session-dev- prefix", key)
+	}
+	if again := authCacheKey(dev); again != key {
+		t.Errorf("authCacheKey changed from %q to %q", key, again)
+	}
+
+	changes := map[string]func(p *AwsAuthProfile){
+		"account":      func(p *AwsAuthProfile) { p.AccountId = "222222222222" },
+		"user name":    func(p *AwsAuthProfile) { p.UserName = "other.user" },
+		"region":       func(p *AwsAuthProfile) { p.Region = "us-west-2" },
+		"endpoint url": func(p *AwsAuthProfile) { p.EndpointUrl = "http://localhost:4566" },
+	}
+	for name, change := range changes {
+		other := dev
+		change(&other)
+		if authCacheKey(other) == key {
+			t.Errorf("authCacheKey doesn't change with the %s", name)
+		}
+	}
+
+	// the region overridden in the environment is the one STS is called in
+	os.Setenv("PORTRAY_REGION", "us-west-2")
+	defer os.Unsetenv("PORTRAY_REGION")
+	overridden := authCacheKey(dev)
+	other := dev
+	other.Region = "us-west-2"
+	if overridden == key || overridden != authCacheKey(other) {
+		t.Errorf("authCacheKey ignores PORTRAY_REGION")
+	}
+}
+
+func TestRoleCacheKey(t *testing.T) {
+	loadConfig(t, chainConfig)
+	os.Unsetenv("PORTRAY_REGION")
+	os.Unsetenv("PORTRAY_ENDPOINT_URL")
+
+	admin, _ := lookupRoleProfile("Admin")
+	chain, err := lookupRoleChain(admin)
+	if err != nil {
+		t.Fatalf("lookupRoleChain failed: %s", err)
+	}
+	key := roleCacheKey(chain, util.AwsCreds{})
+	if !strings.HasPrefix(key, "role-session-222222222222_Admin-") {
+		t.Errorf("roleCacheKey = %q, want a role-session-222222222222_Admin- prefix", key)
+	}
+
+	fromCurrent := roleCacheKey(chain, util.AwsCreds{AccessKeyID: "ASIAEXAMPLE"})
+	if fromCurrent == key {
+		t.Error("roleCacheKey doesn't change with the source session")
+	}
+
+	external := chain[0]
+	external.ExternalId = "other"
+	if roleCacheKey([]AwsRoleProfile{external}, util.AwsCreds{}) == key {
+		t.Error("roleCacheKey doesn't change with the external id")
+	}
+
+	deploy, _ := lookupRoleProfile("Deploy")
+	deployChain, err := lookupRoleChain(deploy)
+	if err != nil {
+		t.Fatalf("lookupRoleChain failed: %s", err)
+	}
+	direct := deployChain[len(deployChain)-1]
+	direct.SourceProfile = "dev"
+	if roleCacheKey(deployChain, util.AwsCreds{}) == roleCacheKey([]AwsRoleProfile{direct}, util.AwsCreds{}) {
+		t.Error("roleCacheKey doesn't change with the role the session is assumed from")
+	}
+}
+
+func TestCachedSessionMigration(t *testing.T) {
+	defer func(store util.CredentialStore) { cacheStore = store }(cacheStore)
+	cacheStore = &util.MemoryStore{}
+
+	dev := AwsAuthProfile{Name: "dev", AccountId: "111111111111", UserName: "user.name"}
+	key := authCacheKey(dev)
+	legacyKey := legacyAuthCacheKey(dev)
+	legacy := util.AwsCreds{AccessKeyID: "ASIALEGACY", SecretAccessKey: "secret", SessionToken: "token", Expiration: 1700000000}
+	cacheStore.Put(legacyKey, legacy)
+
+	awsCreds := cachedSession(key, legacyKey, util.SessionMetadata{Profile: "dev"})
+	if awsCreds.AccessKeyID != legacy.AccessKeyID {
+		t.Fatalf("cachedSession = %+v, want the legacy session", awsCreds)
+	}
+	if awsCreds.Version != util.CacheVersion || awsCreds.Metadata.Profile != "dev" {
+		t.Errorf("migrated session = %+v, want version %d with metadata", awsCreds, util.CacheVersion)
+	}
+	if !awsCreds.Metadata.MfaUnknown {
+		t.Error("migrated session doesn't have MfaUnknown set")
+	}
+	if missingMfa(awsCreds, sessionOptions{}) {
+		t.Error("migrated session is discarded for lacking MFA")
+	}
+
+	if moved, _ := cacheStore.Get(key); moved.AccessKeyID != legacy.AccessKeyID {
+		t.Errorf("session under the new key = %+v, want the legacy session", moved)
+	}
+	if old, _ := cacheStore.Get(legacyKey); old.SessionToken != "" {
+		t.Errorf("session under the legacy key = %+v, want it deleted", old)
+	}
+
+	// sessions known to be started without MFA aren't reused when it's wanted
+	noMfa := util.AwsCreds{SessionToken: "token", Version: util.CacheVersion}
+	if !missingMfa(noMfa, sessionOptions{}) {
+		t.Error("session without MFA is reused when MFA is wanted")
+	}
+	if missingMfa(noMfa, sessionOptions{NoMfa: true}) {
+		t.Error("session without MFA isn't reused with NoMfa")
+	}
+}
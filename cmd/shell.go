@@ -0,0 +1,164 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jasonamyers/portray/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// defaultRenewBefore is how long before a role session expires it's renewed
+// in a session shell, unless the profile has a longer MinRemaining
+const defaultRenewBefore = 5 * time.Minute
+
+var shellRenew bool
+var shellPurgeOnExit bool
+var shellNoNest bool
+var shellCleanEnv bool
+
+// addShellFlags adds the flags of commands that start a session shell.
+func addShellFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&shellRenew, "renew", false, "renew the role session before it expires and write it to $PORTRAY_ENV_FILE")
+	cmd.Flags().BoolVar(&shellPurgeOnExit, "purge-on-exit", false, "delete the cached session when the shell exits")
+	cmd.Flags().BoolVar(&shellNoNest, "no-nest", false, "refuse to start a shell inside another portray shell")
+	cmd.Flags().BoolVar(&shellCleanEnv, "clean-env", false, "start the shell with a minimal environment instead of the current one")
+}
+
+// sessionEnviron returns the environment, in os.Environ form, of a shell or
+// command run with a session. With cleanEnv it starts from a minimal
+// environment rather than the current one.
+func sessionEnviron(awsCreds util.AwsCreds, info util.SessionInfo, cleanEnv bool) []string {
+	environ := os.Environ()
+	if cleanEnv {
+		environ = util.MinimalEnv(environ)
+	}
+	return util.MergeEnv(environ, util.SessionEnv(awsCreds, info))
+}
+
+// checkNesting warns the user when a shell is about to be started inside
+// another portray shell, or exits if --no-nest or NoNest is set.
+func checkNesting() {
+	depth := util.ShellDepth()
+	if depth == 0 {
+		return
+	}
+
+	stack := strings.Join(util.ShellStack(), util.StackSeparator)
+	if shellNoNest || viper.GetBool("NoNest") {
+		fmt.Printf("Error! Already in a portray shell for %s. Exit it first, or use switch --from-current to assume a role with its session\n", stack)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Warning! Already in a portray shell for %s. Starting a nested shell at depth %d\n", stack, depth+1)
+}
+
+// startShell runs a shell with a session, then exits with the shell's exit
+// code. The session cached under cacheKey is deleted when the shell exits if
+// --purge-on-exit or PurgeOnExit is set. Sessions that can be renewed pass a
+// renew function, which is used with --renew or RenewSession.
+func startShell(sessionName string, awsCreds util.AwsCreds, info util.SessionInfo, cacheKey string, renew func() (util.AwsCreds, bool), renewBefore time.Duration) {
+	nestEnv, err := util.NestEnv(info)
+	util.CheckError(err)
+
+	shell := util.Shell{
+		Path:       viper.GetString("Shell"),
+		Env:        util.MergeEnv(sessionEnviron(awsCreds, info, shellCleanEnv), nestEnv),
+		Expiration: awsCreds.Expiration,
+		Info:       info,
+	}
+	// Renewed sessions are written in plaintext, whatever the CacheBackend,
+	// so they're kept in a directory only the user can read.
+	var envDir string
+	if renew != nil && (shellRenew || viper.GetBool("RenewSession")) {
+		envDir, err = ioutil.TempDir("", "portray-env-")
+		util.CheckError(err)
+		shell.Renew = renew
+		shell.RenewBefore = renewBefore
+		shell.EnvFile = filepath.Join(envDir, "env")
+	}
+
+	code := util.StartShell(sessionName, shell)
+	if envDir != "" {
+		os.RemoveAll(envDir)
+	}
+
+	if shellPurgeOnExit || viper.GetBool("PurgeOnExit") {
+		err := cacheStore.Delete(cacheKey)
+		util.CheckError(err)
+		fmt.Fprintf(os.Stderr, "Deleted cached session %s\n", cacheKey)
+	}
+
+	os.Exit(code)
+}
+
+// roleRenewal returns how to renew the session of the last role of a chain
+// from a session shell, and how long before it expires to do so. Sessions
+// are only renewed when that doesn't need an MFA token, since the shell has
+// the terminal.
+func roleRenewal(chain []AwsRoleProfile, opts sessionOptions) (func() (util.AwsCreds, bool), time.Duration) {
+	renewBefore := opts.minRemaining(chain[len(chain)-1].MinRemaining)
+	if renewBefore < defaultRenewBefore {
+		renewBefore = defaultRenewBefore
+	}
+
+	renew := func() (util.AwsCreds, bool) {
+		// Roles assumed with the session of the outer portray shell are
+		// renewed with it, and STS says so if it has expired.
+		first := chain[0]
+		fromProfile := opts.SourceCreds.SessionToken == ""
+		if fromProfile && viper.IsSet("AuthProfiles."+first.SourceProfile) {
+			authProfile := readAuthProfile(first.SourceProfile)
+			awsCreds := cachedSession(authCacheKey(authProfile), legacyAuthCacheKey(authProfile), util.SessionMetadata{
+				Profile: authProfile.Name,
+			})
+			if awsCreds.SessionToken == "" || !util.ValidateSession(awsCreds) {
+				fmt.Fprintf(os.Stderr, "\nportray: unable to renew the session, the session of %s has expired\n", authProfile.Name)
+				return util.AwsCreds{}, false
+			}
+			if missingMfa(awsCreds, opts) {
+				fmt.Fprintln(os.Stderr, "\nportray: unable to renew the session without prompting for an MFA token")
+				return util.AwsCreds{}, false
+			}
+		} else if fromProfile && first.MfaSerial != "" && !opts.NoMfa {
+			fmt.Fprintln(os.Stderr, "\nportray: unable to renew the session without prompting for an MFA token")
+			return util.AwsCreds{}, false
+		}
+
+		// the token passed on the command line has been used already
+		renewOpts := opts
+		renewOpts.TokenCode = ""
+		renewOpts.MinRemaining = renewBefore
+		awsCreds, err := fetchRoleSession(chain, renewOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nportray: unable to renew the session: %s\n", err)
+			return util.AwsCreds{}, false
+		}
+		return awsCreds, true
+	}
+
+	return renew, renewBefore
+}
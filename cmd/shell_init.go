@@ -0,0 +1,258 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// shellInitCmd represents the shell-init command
+var shellInitCmd = &cobra.Command{
+	Use:   "shell-init <bash|zsh|fish|powershell>",
+	Short: "prints shell integration to load from your rc file",
+	Long: `The shell-init command prints functions for a shell, to be loaded from
+its rc file:
+
+  bash:       eval "$(portray shell-init bash)"      in ~/.bashrc
+  zsh:        eval "$(portray shell-init zsh)"       in ~/.zshrc
+  fish:       portray shell-init fish | source       in ~/.config/fish/config.fish
+  powershell: portray shell-init powershell | Out-String | Invoke-Expression
+              in $PROFILE
+
+It defines __portray_prompt, which prints the prompt of the current session
+to add to your own prompt, and portray-use <profile>, which loads a session
+into the current shell with portray env instead of starting a new one.
+portray-use and the --profile flag of portray complete the names of your
+profiles, and a hook run before each prompt loads renewed sessions and warns
+when the session has expired.`,
+	ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+	Args:      cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		script, ok := shellInitScripts[args[0]]
+		if !ok {
+			fmt.Printf("Unknown shell %s! Valid values are bash, zsh, fish and powershell\n", args[0])
+			os.Exit(1)
+		}
+
+		var commands []string
+		for _, c := range rootCmd.Commands() {
+			if !c.Hidden {
+				commands = append(commands, c.Name())
+			}
+		}
+
+		fmt.Print(strings.Replace(script, "PORTRAY_COMMANDS", strings.Join(commands, " "), -1))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(shellInitCmd)
+}
+
+// shellInitScripts are the integration scripts for each shell, with
+// PORTRAY_COMMANDS replaced by the names of the subcommands
+var shellInitScripts = map[string]string{
+	"bash": `# portray shell integration for bash
+__portray_prompt() {
+  [ -n "$PORTRAY_ACCOUNT" ] && portray prompt --shell bash
+}
+
+portray-use() {
+  if [ -z "$1" ]; then
+    echo "usage: portray-use <profile> [portray env flags]" >&2
+    return 1
+  fi
+  local env
+  env="$(portray env --profile "$1" --format bash "${@:2}")" && eval "$env"
+}
+
+__portray_hook() {
+  if [ -n "$PORTRAY_ENV_FILE" ] && [ -f "$PORTRAY_ENV_FILE" ]; then
+    . "$PORTRAY_ENV_FILE" && rm -f "$PORTRAY_ENV_FILE"
+    echo "portray: loaded the renewed session" >&2
+  fi
+  if [ -n "$PORTRAY_EXPIRATION" ] && [ "$(date +%s)" -ge "$PORTRAY_EXPIRATION" ] &&
+    [ "$__portray_warned" != "$PORTRAY_EXPIRATION" ]; then
+    echo "portray: the session in this shell has expired" >&2
+    __portray_warned="$PORTRAY_EXPIRATION"
+  fi
+}
+
+case ";$PROMPT_COMMAND;" in
+  *";__portray_hook;"*) ;;
+  *) PROMPT_COMMAND="__portray_hook${PROMPT_COMMAND:+;$PROMPT_COMMAND}" ;;
+esac
+
+_portray_use() {
+  COMPREPLY=($(compgen -W "$(portray profiles 2>/dev/null)" -- "${COMP_WORDS[COMP_CWORD]}"))
+}
+
+_portray() {
+  local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+  case "$prev" in
+    -p|--profile) COMPREPLY=($(compgen -W "$(portray profiles 2>/dev/null)" -- "$cur")) ;;
+    *) [ "$COMP_CWORD" -eq 1 ] && COMPREPLY=($(compgen -W "PORTRAY_COMMANDS" -- "$cur")) ;;
+  esac
+}
+
+complete -F _portray_use portray-use
+complete -o default -F _portray portray
+`,
+
+	"zsh": `# portray shell integration for zsh
+setopt prompt_subst
+
+__portray_prompt() {
+  [[ -n "$PORTRAY_ACCOUNT" ]] && portray prompt --shell zsh
+}
+
+portray-use() {
+  if [[ -z "$1" ]]; then
+    echo "usage: portray-use <profile> [portray env flags]" >&2
+    return 1
+  fi
+  local env
+  env="$(portray env --profile "$1" --format zsh "${@:2}")" && eval "$env"
+}
+
+__portray_hook() {
+  if [[ -n "$PORTRAY_ENV_FILE" && -f "$PORTRAY_ENV_FILE" ]]; then
+    . "$PORTRAY_ENV_FILE" && rm -f "$PORTRAY_ENV_FILE"
+    echo "portray: loaded the renewed session" >&2
+  fi
+  if [[ -n "$PORTRAY_EXPIRATION" ]] && (( $(date +%s) >= PORTRAY_EXPIRATION )) &&
+    [[ "$__portray_warned" != "$PORTRAY_EXPIRATION" ]]; then
+    echo "portray: the session in this shell has expired" >&2
+    __portray_warned="$PORTRAY_EXPIRATION"
+  fi
+}
+
+autoload -Uz add-zsh-hook
+add-zsh-hook precmd __portray_hook
+
+_portray_use() {
+  local -a profiles
+  profiles=(${(f)"$(portray profiles 2>/dev/null)"})
+  _describe 'profile' profiles
+}
+
+_portray() {
+  if [[ "$words[CURRENT-1]" == (-p|--profile) ]]; then
+    _portray_use
+  elif (( CURRENT == 2 )); then
+    local -a commands
+    commands=(PORTRAY_COMMANDS)
+    _describe 'command' commands
+  else
+    _files
+  fi
+}
+
+if (( $+functions[compdef] )); then
+  compdef _portray_use portray-use
+  compdef _portray portray
+fi
+`,
+
+	"fish": `# portray shell integration for fish
+function __portray_prompt
+    if set -q PORTRAY_ACCOUNT
+        portray prompt
+    end
+end
+
+function portray-use
+    if test (count $argv) -lt 1
+        echo "usage: portray-use <profile> [portray env flags]" >&2
+        return 1
+    end
+    set -l env (portray env --profile $argv[1] --format fish $argv[2..-1])
+    and printf '%s\n' $env | source
+end
+
+function __portray_hook --on-event fish_prompt
+    if set -q PORTRAY_ENV_FILE; and test -f "$PORTRAY_ENV_FILE"
+        source "$PORTRAY_ENV_FILE"; and rm -f "$PORTRAY_ENV_FILE"
+        echo "portray: loaded the renewed session" >&2
+    end
+    if set -q PORTRAY_EXPIRATION; and test (date +%s) -ge "$PORTRAY_EXPIRATION"
+        if test "$__portray_warned" != "$PORTRAY_EXPIRATION"
+            echo "portray: the session in this shell has expired" >&2
+            set -g __portray_warned $PORTRAY_EXPIRATION
+        end
+    end
+end
+
+complete -c portray-use -f -a '(portray profiles 2>/dev/null)'
+complete -c portray -f -n '__fish_use_subcommand' -a 'PORTRAY_COMMANDS'
+complete -c portray -s p -l profile -x -a '(portray profiles 2>/dev/null)'
+`,
+
+	"powershell": `# portray shell integration for PowerShell
+function __portray_prompt {
+    if ($Env:PORTRAY_ACCOUNT) { portray prompt }
+}
+
+function portray-use {
+    param([Parameter(Mandatory = $true)][string]$Name, [Parameter(ValueFromRemainingArguments = $true)]$Rest)
+    $statements = portray env --profile $Name --format powershell @Rest
+    if ($LASTEXITCODE -eq 0) { $statements | Out-String | Invoke-Expression }
+}
+
+function __portray_hook {
+    if ($Env:PORTRAY_ENV_FILE -and (Test-Path $Env:PORTRAY_ENV_FILE)) {
+        Get-Content $Env:PORTRAY_ENV_FILE | Out-String | Invoke-Expression
+        Remove-Item $Env:PORTRAY_ENV_FILE
+        Write-Host "portray: loaded the renewed session"
+    }
+    if ($Env:PORTRAY_EXPIRATION -and ([DateTimeOffset]::UtcNow.ToUnixTimeSeconds() -ge [long]$Env:PORTRAY_EXPIRATION) -and
+        ($global:__portray_warned -ne $Env:PORTRAY_EXPIRATION)) {
+        Write-Warning "portray: the session in this shell has expired"
+        $global:__portray_warned = $Env:PORTRAY_EXPIRATION
+    }
+}
+
+if (-not $global:__portray_prompt_wrapped) {
+    $global:__portray_original_prompt = $function:prompt
+    function global:prompt { __portray_hook; & $global:__portray_original_prompt }
+    $global:__portray_prompt_wrapped = $true
+}
+
+Register-ArgumentCompleter -CommandName portray-use -ParameterName Name -ScriptBlock {
+    param($commandName, $parameterName, $wordToComplete)
+    portray profiles 2>$null | Where-Object { $_ -like "$wordToComplete*" }
+}
+
+Register-ArgumentCompleter -Native -CommandName portray -ScriptBlock {
+    param($wordToComplete, $commandAst)
+    $words = $commandAst.CommandElements | ForEach-Object { $_.ToString() }
+    $previous = if ($wordToComplete) { $words[-2] } else { $words[-1] }
+    if ($previous -in '-p', '--profile') {
+        portray profiles 2>$null | Where-Object { $_ -like "$wordToComplete*" }
+    } elseif ($words.Count -le 2) {
+        'PORTRAY_COMMANDS'.Split(' ') | Where-Object { $_ -like "$wordToComplete*" }
+    }
+}
+`,
+}
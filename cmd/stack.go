@@ -0,0 +1,56 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jasonamyers/portray/util"
+	"github.com/spf13/cobra"
+)
+
+// stackCmd represents the stack command
+var stackCmd = &cobra.Command{
+	Use:   "stack",
+	Short: "lists the portray shells you're in",
+	Long: `The stack command lists the portray shells the current shell is nested
+in, from the outermost to the current one.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		stack := util.ShellStack()
+		if len(stack) == 0 {
+			fmt.Println("Not in a portray shell")
+			os.Exit(1)
+		}
+
+		for i, entry := range stack {
+			if i == len(stack)-1 {
+				fmt.Printf("%d  %s (current, session %s)\n", i+1, entry, os.Getenv("PORTRAY_SESSION_ID"))
+			} else {
+				fmt.Printf("%d  %s\n", i+1, entry)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(stackCmd)
+}
@@ -22,21 +22,23 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"os/user"
 	"strings"
 	"time"
 
 	"github.com/jasonamyers/portray/util"
-	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var roleAccountId string
-var roleArn string
 var roleName string
 var roleExternalId string
 var roleProfile string
+var roleMfaSerial string
+var roleTokenCode string
+var roleNoMfa bool
+var roleDuration time.Duration
+var roleFromCurrent bool
 
 // switchCmd represents the switch command
 var switchCmd = &cobra.Command{
@@ -45,16 +47,23 @@ var switchCmd = &cobra.Command{
 	Long: `The switch command allows you to assume a role via a named profile
 or by passing in the account and role details directly.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if roleProfile == "" && (roleAccountId == "" || roleName == "") {
+		roleNameIsArn := strings.HasPrefix(roleName, "arn:")
+		if roleProfile == "" && (roleName == "" || (roleAccountId == "" && !roleNameIsArn)) {
 			fmt.Println("Error! Use either a named profile or manually specify both account and role")
 			fmt.Println("See portray switch -h for options")
 			os.Exit(1)
 		}
 
+		if !roleFromCurrent {
+			checkNesting()
+		} else if util.ShellDepth() == 0 || util.EnvCreds().SessionToken == "" {
+			fmt.Println("Error! --from-current can only be used in a portray shell")
+			os.Exit(1)
+		}
+
+		var roleConfig AwsRoleProfile
 		if roleProfile != "" {
 			if viper.IsSet("Profiles." + roleProfile) {
-				profileKey := "Profiles." + roleProfile + "."
-
 				if roleAccountId != "" {
 					fmt.Println("Error! Can't specify alternate account for a configured profile")
 					os.Exit(1)
@@ -66,65 +75,70 @@ or by passing in the account and role details directly.`,
 				}
 
 				fmt.Printf("Found profile %s in config\n", roleProfile)
-
-				// get role arn from profile
-				roleArn = viper.GetString(profileKey + "RoleArn")
-				if roleArn == "" {
-					fmt.Println("Error! Couldn't find RoleArn in profile config")
-					os.Exit(1)
+				roleConfig = readRoleProfile(roleProfile)
+				roleAccountId = roleArnAccountId(roleConfig)
+				roleName = roleConfig.RoleName
+				if roleMfaSerial != "" {
+					roleConfig.MfaSerial = roleMfaSerial
 				}
-				// get role name from role arn
-				roleName = strings.Split(roleArn, "/")[1]
-				// get account id from role arn
-				roleAccountId = strings.Split(roleArn, ":")[4]
-				// get external id from profile
-				roleExternalId = viper.GetString(profileKey + "ExternalId")
-
 			} else {
 				fmt.Printf("Error! Unable to find profile %s in config. Is it set in the Profiles section?\n", roleProfile)
 				os.Exit(1)
 			}
 		} else { // user has not specified profile
 			// user has not specified account
-			if roleAccountId == "" || roleName == "" {
+			if (roleAccountId == "" && !roleNameIsArn) || roleName == "" {
 				fmt.Println("Error! When not using named profiles, you must specify both the account and the role name")
 				os.Exit(1)
 			}
-		}
-
-		currentUser, err := user.Current()
-		util.CheckError(err)
-
-		home, err := homedir.Dir()
-		util.CheckError(err)
-		roleFileName := home + "/.aws/portray-role-session-" + roleAccountId + "_" + roleName + ".json"
-		awsCreds := util.GetCredsFromFile(roleFileName)
 
-		// If there's no valid session cache, generate a new session.
-		if awsCreds.SessionToken == "" || !util.ValidateSession(awsCreds) {
-			fmt.Printf("No session cache found or cache expired. Assuming role %s in account %s\n", roleName, roleAccountId)
-
-			awsCreds = util.GetNewRoleSession(
-				roleAccountId,
-				roleName,
-				roleExternalId,
-				*currentUser)
-
-			util.WriteSessionFile(awsCreds, roleFileName)
-		} else {
-			// Found a cached sessions that's still valid
-			fmt.Println("Using cached session credentials")
-
-			// Check how much time is left on the session so we can tell the user
-			sessionExpiration := time.Unix(awsCreds.Expiration, 0)
-			currentTime := time.Now()
-			sessionTimeLeft := sessionExpiration.Sub(currentTime)
+			// the role can be a name, optionally with a path, or a full arn
+			roleConfig = AwsRoleProfile{
+				RoleArn:    roleName,
+				MfaSerial:  roleMfaSerial,
+				ExternalId: roleExternalId,
+			}
+			if !roleNameIsArn {
+				region := profileEndpoint("", "", "").Region
+				roleConfig.RoleArn = util.NewIamArn(region, roleAccountId, "role/"+roleName).String()
+			}
 
-			fmt.Printf("Session valid for %+v\n", util.Round(sessionTimeLeft, time.Second))
+			roleArn, err := util.ParseIamArn(roleConfig.RoleArn, "role")
+			util.CheckError(err)
+			if roleAccountId != "" && roleAccountId != roleArn.AccountId {
+				fmt.Println("Error! The account doesn't match the account of the role arn")
+				os.Exit(1)
+			}
+			roleConfig.RoleName = roleArn.Name()
+			roleAccountId = roleArn.AccountId
+			roleName = roleArn.Name()
 		}
 
-		util.SessionToEnvVars(awsCreds, roleAccountId, roleName, roleProfile)
-		util.StartShell(roleAccountId)
+		chain := roleChain(roleConfig)
+		opts := sessionOptions{
+			TokenCode:       roleTokenCode,
+			NoMfa:           roleNoMfa || viper.GetBool("NoMfa"),
+			DurationSeconds: int64(roleDuration.Seconds()),
+			MinRemaining:    minRemaining,
+		}
+		if roleFromCurrent {
+			// assume the role directly with the session of this shell
+			chain = chain[len(chain)-1:]
+			opts.SourceCreds = util.EnvCreds()
+		}
+		awsCreds := loadRoleSession(chain, opts)
+
+		info := util.SessionInfo{
+			AccountId: roleAccountId,
+			RoleName:  roleName,
+			Profile:   roleProfile,
+			Region:    profileEndpoint(chain[len(chain)-1].Region, "", "").Region,
+			Env:       profileEnv(chain[len(chain)-1].Env),
+			Chain:     chainPath(chain),
+		}
+		info = withPrompt(info, roleConfig.AccountAlias, roleConfig.Environment, roleConfig.PromptColor)
+		renew, renewBefore := roleRenewal(chain, opts)
+		startShell(roleAccountId, awsCreds, info, roleCacheKey(chain, opts.SourceCreds), renew, renewBefore)
 	},
 }
 
@@ -132,9 +146,15 @@ func init() {
 	rootCmd.AddCommand(switchCmd)
 
 	switchCmd.Flags().StringVarP(&roleAccountId, "account", "a", "", "the 12-digit AWS account ID")
-	switchCmd.Flags().StringVarP(&roleName, "role", "r", "", "the name of the role to assume")
+	switchCmd.Flags().StringVarP(&roleName, "role", "r", "", "the name, path/name or arn of the role to assume")
 	switchCmd.Flags().StringVarP(&roleExternalId, "external-id", "e", "", "the ExternalId required to assume the role")
 	switchCmd.Flags().StringVarP(&roleProfile, "profile", "p", "", "the named profile to use (conflicts w/ others)")
+	switchCmd.Flags().StringVarP(&roleMfaSerial, "mfa-serial", "m", "", "the ARN of the MFA device required to assume the role")
+	switchCmd.Flags().StringVarP(&roleTokenCode, "token", "t", "", "an MFA token")
+	switchCmd.Flags().BoolVarP(&roleNoMfa, "no-mfa", "n", false, "disable MFA")
+	switchCmd.Flags().DurationVar(&roleDuration, "duration", 0, "the session duration, e.g. 4h (default 1h or the profile's DurationSeconds)")
+	switchCmd.Flags().BoolVar(&roleFromCurrent, "from-current", false, "assume the role with the session of the portray shell you're in")
+	addShellFlags(switchCmd)
 
 	viper.BindPFlag("AccountId", switchCmd.Flags().Lookup("account"))
 	viper.BindPFlag("Role", switchCmd.Flags().Lookup("role"))
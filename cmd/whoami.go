@@ -0,0 +1,171 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/jasonamyers/portray/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var whoamiOutput string
+
+// whoamiResult is what whoami shows about the session in the environment
+type whoamiResult struct {
+	Arn        string
+	Account    string
+	UserId     string
+	Profile    string `json:",omitempty"`
+	Expiration string `json:",omitempty"`
+	Remaining  string `json:",omitempty"`
+	Expired    bool
+}
+
+// whoamiError is how whoami reports errors with --output json
+type whoamiError struct {
+	Error string
+}
+
+// whoamiCmd represents the whoami command
+var whoamiCmd = &cobra.Command{
+	Use:     "whoami",
+	Aliases: []string{"status"},
+	Short:   "shows who the credentials in the environment belong to",
+	Long: `The whoami command asks STS who the credentials in the environment,
+such as those of the current portray shell, belong to. It shows the ARN,
+account and user id of the principal, along with the portray profile and how
+long the session has left.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if whoamiOutput != "table" && whoamiOutput != "json" {
+			fmt.Printf("Unknown output format %s! Valid values are table and json\n", whoamiOutput)
+			os.Exit(1)
+		}
+
+		awsCreds := util.EnvCreds()
+		if awsCreds.AccessKeyID == "" || awsCreds.SecretAccessKey == "" {
+			whoamiFail("No credentials found in the environment. Start a portray shell, or load a session with portray env")
+		}
+
+		result := whoamiResult{Profile: os.Getenv("PORTRAY_PROFILE")}
+		expiration := envExpiration(awsCreds)
+		if expiration != 0 {
+			result.Expiration = time.Unix(expiration, 0).Format(time.RFC3339)
+			result.Expired = !util.ValidateSession(util.AwsCreds{Expiration: expiration})
+			result.Remaining = "0s"
+			if !result.Expired {
+				result.Remaining = util.Round(time.Unix(expiration, 0).Sub(time.Now()), time.Second).String()
+			}
+		}
+
+		endpoint := profileEndpoint(firstSet(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")), "", "")
+		identity, err := util.GetCallerIdentity(awsCreds, endpoint)
+		if err != nil {
+			whoamiFail(identityError(err, expiration))
+		}
+		result.Arn = identity.Arn
+		result.Account = identity.Account
+		result.UserId = identity.UserId
+
+		switch whoamiOutput {
+		case "table":
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "Arn:\t%s\n", result.Arn)
+			fmt.Fprintf(w, "Account:\t%s\n", result.Account)
+			fmt.Fprintf(w, "UserId:\t%s\n", result.UserId)
+			fmt.Fprintf(w, "Profile:\t%s\n", orDash(result.Profile))
+			fmt.Fprintf(w, "Expiration:\t%s\n", orDash(result.Expiration))
+			fmt.Fprintf(w, "Remaining:\t%s\n", orDash(result.Remaining))
+			fmt.Fprintf(w, "Expired:\t%t\n", result.Expired)
+			w.Flush()
+		case "json":
+			printJSON(result)
+		}
+	},
+}
+
+// envExpiration returns when the session in the environment expires, from
+// PORTRAY_EXPIRATION or AWS_CREDENTIAL_EXPIRATION, or else the cached session
+// of PORTRAY_PROFILE if it's the same session. It's 0 for credentials that
+// portray knows nothing about.
+func envExpiration(awsCreds util.AwsCreds) int64 {
+	if expiration, err := strconv.ParseInt(os.Getenv("PORTRAY_EXPIRATION"), 10, 64); err == nil {
+		return expiration
+	}
+	if expiration, err := time.Parse(time.RFC3339, os.Getenv("AWS_CREDENTIAL_EXPIRATION")); err == nil {
+		return expiration.Unix()
+	}
+
+	profile := os.Getenv("PORTRAY_PROFILE")
+	if profile == "" || (!viper.IsSet("Profiles."+profile) && !viper.IsSet("AuthProfiles."+profile)) {
+		return 0
+	}
+	_, cached := profileCachedSession(profile)
+	if cached.AccessKeyID != awsCreds.AccessKeyID {
+		return 0
+	}
+	return cached.Expiration
+}
+
+// whoamiFail prints an error in the --output format and exits.
+func whoamiFail(message string) {
+	if whoamiOutput == "json" {
+		printJSON(whoamiError{Error: message})
+	} else {
+		fmt.Printf("Error! %s\n", message)
+	}
+	os.Exit(1)
+}
+
+// identityError explains why STS refused to say who a session belongs to.
+func identityError(err error, expiration int64) string {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return err.Error()
+	}
+
+	switch awsErr.Code() {
+	case "ExpiredToken", "ExpiredTokenException":
+		if expiration != 0 {
+			return fmt.Sprintf("The session expired at %s. Start a new one with portray auth or portray switch", time.Unix(expiration, 0).Format(time.RFC3339))
+		}
+		return "The session has expired. Start a new one with portray auth or portray switch"
+	case "InvalidClientTokenId", "UnrecognizedClientException":
+		return "The access key in the environment isn't valid. It may belong to a session that was revoked, or be mistyped"
+	case "SignatureDoesNotMatch":
+		return "The secret access key in the environment doesn't match the access key"
+	case "RequestError":
+		return fmt.Sprintf("Unable to reach STS. %s", awsErr.OrigErr())
+	}
+	return err.Error()
+}
+
+func init() {
+	rootCmd.AddCommand(whoamiCmd)
+
+	whoamiCmd.Flags().StringVarP(&whoamiOutput, "output", "o", "table", "the output format: table or json")
+}
@@ -0,0 +1,112 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+// accountIdPattern matches a 12-digit AWS account id
+var accountIdPattern = regexp.MustCompile(`^\d{12}$`)
+
+// Arn represents an Amazon Resource Name
+type Arn struct {
+	Partition string
+	Service   string
+	Region    string
+	AccountId string
+	Resource  string
+}
+
+// ParseArn splits an ARN into its parts.
+func ParseArn(arn string) (Arn, error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		return Arn{}, fmt.Errorf("Invalid ARN %q: expected arn:partition:service:region:account:resource", arn)
+	}
+	if parts[1] == "" || parts[2] == "" || parts[5] == "" {
+		return Arn{}, fmt.Errorf("Invalid ARN %q: partition, service and resource can't be empty", arn)
+	}
+
+	return Arn{
+		Partition: parts[1],
+		Service:   parts[2],
+		Region:    parts[3],
+		AccountId: parts[4],
+		Resource:  parts[5],
+	}, nil
+}
+
+// ParseIamArn parses the ARN of an IAM resource of the given type, such as
+// "role" or "mfa", checking that it belongs to an account.
+func ParseIamArn(arn string, resourceType string) (Arn, error) {
+	parsed, err := ParseArn(arn)
+	if err != nil {
+		return parsed, err
+	}
+
+	if parsed.Service != "iam" {
+		return parsed, fmt.Errorf("Invalid ARN %q: expected an iam ARN", arn)
+	}
+	if !accountIdPattern.MatchString(parsed.AccountId) {
+		return parsed, fmt.Errorf("Invalid ARN %q: expected a 12-digit account id", arn)
+	}
+	if !strings.HasPrefix(parsed.Resource, resourceType+"/") || parsed.Name() == "" {
+		return parsed, fmt.Errorf("Invalid ARN %q: expected a %s/<name> resource", arn, resourceType)
+	}
+
+	return parsed, nil
+}
+
+// NewIamArn returns the ARN of an IAM resource, such as "role/Admin", in
+// the partition of a region.
+func NewIamArn(region string, accountId string, resource string) Arn {
+	return Arn{
+		Partition: PartitionForRegion(region),
+		Service:   "iam",
+		AccountId: accountId,
+		Resource:  resource,
+	}
+}
+
+// Name returns the last element of the resource, e.g. the name of a role
+// without its path.
+func (arn Arn) Name() string {
+	return arn.Resource[strings.LastIndexAny(arn.Resource, "/:")+1:]
+}
+
+func (arn Arn) String() string {
+	return strings.Join([]string{"arn", arn.Partition, arn.Service, arn.Region, arn.AccountId, arn.Resource}, ":")
+}
+
+// PartitionForRegion returns the partition a region belongs to, such as
+// "aws-cn" or "aws-us-gov", or "aws" for unknown and empty regions.
+func PartitionForRegion(region string) string {
+	if region != "" {
+		if partition, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok {
+			return partition.ID()
+		}
+	}
+	return "aws"
+}
@@ -0,0 +1,112 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package util
+
+import "testing"
+
+func TestParseIamArn(t *testing.T) {
+	tests := []struct {
+		name         string
+		arn          string
+		resourceType string
+		want         Arn
+		wantName     string
+		wantErr      bool
+	}{
+		{
+			name:         "role",
+			arn:          "arn:aws:iam::123456789012:role/Admin",
+			resourceType: "role",
+			want:         Arn{Partition: "aws", Service: "iam", AccountId: "123456789012", Resource: "role/Admin"},
+			wantName:     "Admin",
+		},
+		{
+			name:         "role with path",
+			arn:          "arn:aws:iam::123456789012:role/teams/ops/Admin",
+			resourceType: "role",
+			want:         Arn{Partition: "aws", Service: "iam", AccountId: "123456789012", Resource: "role/teams/ops/Admin"},
+			wantName:     "Admin",
+		},
+		{
+			name:         "GovCloud",
+			arn:          "arn:aws-us-gov:iam::123456789012:role/Admin",
+			resourceType: "role",
+			want:         Arn{Partition: "aws-us-gov", Service: "iam", AccountId: "123456789012", Resource: "role/Admin"},
+			wantName:     "Admin",
+		},
+		{
+			name:         "China",
+			arn:          "arn:aws-cn:iam::123456789012:mfa/user.name",
+			resourceType: "mfa",
+			want:         Arn{Partition: "aws-cn", Service: "iam", AccountId: "123456789012", Resource: "mfa/user.name"},
+			wantName:     "user.name",
+		},
+		{name: "not an arn", arn: "Admin", resourceType: "role", wantErr: true},
+		{name: "too few parts", arn: "arn:aws:iam::123456789012", resourceType: "role", wantErr: true},
+		{name: "empty partition", arn: "arn::iam::123456789012:role/Admin", resourceType: "role", wantErr: true},
+		{name: "other service", arn: "arn:aws:sts::123456789012:role/Admin", resourceType: "role", wantErr: true},
+		{name: "short account id", arn: "arn:aws:iam::12345:role/Admin", resourceType: "role", wantErr: true},
+		{name: "other resource type", arn: "arn:aws:iam::123456789012:user/Admin", resourceType: "role", wantErr: true},
+		{name: "no name", arn: "arn:aws:iam::123456789012:role/", resourceType: "role", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseIamArn(test.arn, test.resourceType)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("ParseIamArn(%q) = %+v, want an error", test.arn, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseIamArn(%q) failed: %s", test.arn, err)
+			}
+			if got != test.want {
+				t.Errorf("ParseIamArn(%q) = %+v, want %+v", test.arn, got, test.want)
+			}
+			if got.Name() != test.wantName {
+				t.Errorf("Name() = %q, want %q", got.Name(), test.wantName)
+			}
+			if got.String() != test.arn {
+				t.Errorf("String() = %q, want %q", got.String(), test.arn)
+			}
+		})
+	}
+}
+
+func TestPartitionForRegion(t *testing.T) {
+	tests := []struct {
+		region string
+		want   string
+	}{
+		{"us-east-1", "aws"},
+		{"eu-west-1", "aws"},
+		{"us-gov-west-1", "aws-us-gov"},
+		{"cn-north-1", "aws-cn"},
+		{"", "aws"},
+		{"nowhere-1", "aws"},
+	}
+
+	for _, test := range tests {
+		if got := PartitionForRegion(test.region); got != test.want {
+			t.Errorf("PartitionForRegion(%q) = %q, want %q", test.region, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// consoleDomains are the sign-in and console domains of each partition
+var consoleDomains = map[string][2]string{
+	"aws":        {"signin.aws.amazon.com", "console.aws.amazon.com"},
+	"aws-cn":     {"signin.amazonaws.cn", "console.amazonaws.cn"},
+	"aws-us-gov": {"signin.amazonaws-us-gov.com", "console.amazonaws-us-gov.com"},
+}
+
+// ConsoleServices maps shortcuts for console services to the path of their
+// home page. Other service names are used as the path as they are.
+var ConsoleServices = map[string]string{
+	"cfn":        "cloudformation/home",
+	"cloudwatch": "cloudwatch/home",
+	"cw":         "cloudwatch/home",
+	"ddb":        "dynamodbv2/home",
+	"dynamodb":   "dynamodbv2/home",
+	"ec2":        "ec2/home",
+	"ecr":        "ecr/home",
+	"ecs":        "ecs/home",
+	"eks":        "eks/home",
+	"iam":        "iam/home",
+	"kms":        "kms/home",
+	"lambda":     "lambda/home",
+	"logs":       "cloudwatch/home#logsV2:",
+	"r53":        "route53/home",
+	"rds":        "rds/home",
+	"s3":         "s3/home",
+	"secrets":    "secretsmanager/home",
+	"sns":        "sns/home",
+	"sqs":        "sqs/home",
+	"ssm":        "systems-manager/home",
+	"vpc":        "vpc/home",
+}
+
+// FederationUrl returns the federation endpoint of the partition of a
+// region.
+func FederationUrl(region string) string {
+	return "https://" + consoleDomains[PartitionForRegion(region)][0] + "/federation"
+}
+
+// ConsoleUrl returns the console page of a service in a region, or the
+// console home page if service is empty.
+func ConsoleUrl(service string, region string) string {
+	path := "console/home"
+	if service != "" {
+		path = service + "/home"
+		if servicePath, ok := ConsoleServices[service]; ok {
+			path = servicePath
+		}
+	}
+
+	console := "https://" + consoleDomains[PartitionForRegion(region)][1] + "/" + path
+	if region == "" {
+		return console
+	}
+
+	// the query string goes before any fragment of the path
+	fragment := ""
+	if i := strings.Index(console, "#"); i >= 0 {
+		console, fragment = console[:i], console[i:]
+	}
+	return console + "?region=" + url.QueryEscape(region) + fragment
+}
+
+// GetSigninToken exchanges a role session for a console sign-in token at
+// a federation endpoint. A sessionDuration of 0 leaves the length of the
+// console session to the endpoint.
+func GetSigninToken(federationUrl string, awsCreds AwsCreds, sessionDuration time.Duration) (string, error) {
+	session, err := json.Marshal(map[string]string{
+		"sessionId":    awsCreds.AccessKeyID,
+		"sessionKey":   awsCreds.SecretAccessKey,
+		"sessionToken": awsCreds.SessionToken,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("Action", "getSigninToken")
+	params.Set("Session", string(session))
+	if sessionDuration != 0 {
+		params.Set("SessionDuration", strconv.FormatInt(int64(sessionDuration.Seconds()), 10))
+	}
+
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(federationUrl + "?" + params.Encode())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("the federation endpoint refused the session with %s. Only role sessions can sign in to the console", resp.Status)
+	}
+
+	var result struct {
+		SigninToken string
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", err
+	}
+	if result.SigninToken == "" {
+		return "", fmt.Errorf("the federation endpoint returned no sign-in token")
+	}
+	return result.SigninToken, nil
+}
+
+// ConsoleLoginUrl returns the URL that signs in to the console with a
+// sign-in token and then goes to destination.
+func ConsoleLoginUrl(federationUrl string, signinToken string, destination string) string {
+	params := url.Values{}
+	params.Set("Action", "login")
+	params.Set("Issuer", "portray")
+	params.Set("Destination", destination)
+	params.Set("SigninToken", signinToken)
+	return federationUrl + "?" + params.Encode()
+}
+
+// OpenBrowser opens a URL in the default browser.
+func OpenBrowser(link string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", link)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", link)
+	default:
+		cmd = exec.Command("xdg-open", link)
+	}
+	return cmd.Start()
+}
@@ -0,0 +1,150 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// federationStub is a federation endpoint that hands out a sign-in token
+// for the session of ASIAEXAMPLE, recording the last request.
+func federationStub(last *url.Values) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*last = r.URL.Query()
+
+		var session map[string]string
+		json.Unmarshal([]byte(r.URL.Query().Get("Session")), &session)
+		switch {
+		case r.URL.Query().Get("Action") != "getSigninToken":
+			http.Error(w, "Bad action", http.StatusBadRequest)
+		case session["sessionId"] == "AKIAEXAMPLE":
+			// long-term and MFA session credentials can't sign in
+			http.Error(w, "Bad session", http.StatusBadRequest)
+		case session["sessionId"] == "ASIAEMPTY":
+			fmt.Fprint(w, `{}`)
+		default:
+			fmt.Fprint(w, `{"SigninToken":"signin-token"}`)
+		}
+	}))
+}
+
+func TestGetSigninToken(t *testing.T) {
+	var last url.Values
+	server := federationStub(&last)
+	defer server.Close()
+
+	awsCreds := AwsCreds{AccessKeyID: "ASIAEXAMPLE", SecretAccessKey: "secret", SessionToken: "token"}
+	token, err := GetSigninToken(server.URL, awsCreds, time.Hour)
+	if err != nil {
+		t.Fatalf("GetSigninToken failed: %s", err)
+	}
+	if token != "signin-token" {
+		t.Errorf("GetSigninToken = %q, want signin-token", token)
+	}
+	var session map[string]string
+	if err := json.Unmarshal([]byte(last.Get("Session")), &session); err != nil {
+		t.Fatalf("Session isn't JSON: %s", err)
+	}
+	want := map[string]string{"sessionId": "ASIAEXAMPLE", "sessionKey": "secret", "sessionToken": "token"}
+	for key, value := range want {
+		if session[key] != value {
+			t.Errorf("Session %s = %q, want %q", key, session[key], value)
+		}
+	}
+	if got := last.Get("SessionDuration"); got != "3600" {
+		t.Errorf("SessionDuration = %q, want 3600", got)
+	}
+
+	if _, err := GetSigninToken(server.URL, awsCreds, 0); err != nil {
+		t.Fatalf("GetSigninToken failed: %s", err)
+	}
+	if _, ok := last["SessionDuration"]; ok {
+		t.Errorf("SessionDuration = %q, want it left to the endpoint", last.Get("SessionDuration"))
+	}
+
+	for _, accessKeyId := range []string{"AKIAEXAMPLE", "ASIAEMPTY"} {
+		refused := AwsCreds{AccessKeyID: accessKeyId, SecretAccessKey: "secret", SessionToken: "token"}
+		if token, err := GetSigninToken(server.URL, refused, 0); err == nil {
+			t.Errorf("GetSigninToken of %s = %q, want an error", accessKeyId, token)
+		}
+	}
+}
+
+func TestConsoleLoginUrl(t *testing.T) {
+	loginUrl, err := url.Parse(ConsoleLoginUrl("https://signin.aws.amazon.com/federation", "signin-token", ConsoleUrl("s3", "eu-west-1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := loginUrl.Query()
+	want := map[string]string{
+		"Action":      "login",
+		"Issuer":      "portray",
+		"SigninToken": "signin-token",
+		"Destination": "https://console.aws.amazon.com/s3/home?region=eu-west-1",
+	}
+	for key, value := range want {
+		if query.Get(key) != value {
+			t.Errorf("%s = %q, want %q", key, query.Get(key), value)
+		}
+	}
+}
+
+func TestConsoleUrl(t *testing.T) {
+	tests := []struct {
+		service string
+		region  string
+		want    string
+	}{
+		{"", "", "https://console.aws.amazon.com/console/home"},
+		{"", "eu-west-1", "https://console.aws.amazon.com/console/home?region=eu-west-1"},
+		{"cfn", "us-east-1", "https://console.aws.amazon.com/cloudformation/home?region=us-east-1"},
+		{"logs", "us-east-1", "https://console.aws.amazon.com/cloudwatch/home?region=us-east-1#logsV2:"},
+		{"athena", "", "https://console.aws.amazon.com/athena/home"},
+		{"ec2", "cn-north-1", "https://console.amazonaws.cn/ec2/home?region=cn-north-1"},
+		{"", "us-gov-west-1", "https://console.amazonaws-us-gov.com/console/home?region=us-gov-west-1"},
+	}
+
+	for _, test := range tests {
+		if got := ConsoleUrl(test.service, test.region); got != test.want {
+			t.Errorf("ConsoleUrl(%q, %q) = %q, want %q", test.service, test.region, got, test.want)
+		}
+	}
+}
+
+func TestFederationUrl(t *testing.T) {
+	tests := map[string]string{
+		"":              "https://signin.aws.amazon.com/federation",
+		"eu-west-1":     "https://signin.aws.amazon.com/federation",
+		"cn-north-1":    "https://signin.amazonaws.cn/federation",
+		"us-gov-west-1": "https://signin.amazonaws-us-gov.com/federation",
+	}
+
+	for region, want := range tests {
+		if got := FederationUrl(region); got != want {
+			t.Errorf("FederationUrl(%q) = %q, want %q", region, got, want)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+// scrypt parameters for deriving keys from passphrases
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	cacheKeySize = 32
+)
+
+// CacheEncryption configures encryption of the session cache. Encrypted
+// session files are always decrypted when they're read, but new ones are
+// only encrypted when Enabled is set.
+type CacheEncryption struct {
+	Enabled bool
+
+	// KeyFile is read for the key instead of asking for a passphrase.
+	KeyFile string
+
+	// Passphrase returns the passphrase keys are derived from, e.g. by
+	// prompting for it. It's only called once.
+	Passphrase func() string
+
+	passphrase *string
+}
+
+// encryptedSession is the format of encrypted session files. The session
+// JSON is encrypted with AES-256-GCM, using a key derived from a passphrase
+// with scrypt or from a key file with HKDF.
+type encryptedSession struct {
+	Version    int
+	Kdf        string
+	Salt       []byte
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+// IsEncrypted reports whether session file data is encrypted.
+func IsEncrypted(data []byte) bool {
+	var envelope encryptedSession
+	err := json.Unmarshal(data, &envelope)
+	return err == nil && envelope.Kdf != "" && len(envelope.Ciphertext) > 0
+}
+
+// Encrypt encrypts session file data.
+func (enc *CacheEncryption) Encrypt(plaintext []byte) ([]byte, error) {
+	envelope := encryptedSession{Version: 1, Kdf: "scrypt"}
+	if enc.KeyFile != "" {
+		envelope.Kdf = "keyfile"
+	}
+
+	envelope.Salt = make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, envelope.Salt); err != nil {
+		return nil, err
+	}
+
+	gcm, err := enc.cipher(envelope.Kdf, envelope.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, envelope.Nonce); err != nil {
+		return nil, err
+	}
+	envelope.Ciphertext = gcm.Seal(nil, envelope.Nonce, plaintext, nil)
+
+	return json.Marshal(envelope)
+}
+
+// Decrypt decrypts session file data written by Encrypt.
+func (enc *CacheEncryption) Decrypt(data []byte) ([]byte, error) {
+	var envelope encryptedSession
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	if envelope.Version != 1 {
+		return nil, fmt.Errorf("unsupported encrypted session version %d", envelope.Version)
+	}
+
+	gcm, err := enc.cipher(envelope.Kdf, envelope.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := gcm.Open(nil, envelope.Nonce, envelope.Ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("unable to decrypt session, wrong passphrase or key file?")
+	}
+
+	return plaintext, nil
+}
+
+// cipher derives the key for a session file and returns an AES-GCM cipher
+// using it.
+func (enc *CacheEncryption) cipher(kdf string, salt []byte) (cipher.AEAD, error) {
+	var key []byte
+
+	switch kdf {
+	case "keyfile":
+		if enc.KeyFile == "" {
+			return nil, errors.New("session was encrypted with a key file, but CacheKeyFile isn't set")
+		}
+		keyFile, err := homedir.Expand(enc.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		keyData, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		key = make([]byte, cacheKeySize)
+		reader := hkdf.New(sha256.New, keyData, salt, []byte("portray session cache"))
+		if _, err := io.ReadFull(reader, key); err != nil {
+			return nil, err
+		}
+	case "scrypt":
+		if enc.passphrase == nil {
+			if enc.Passphrase == nil {
+				return nil, errors.New("session is encrypted, but no passphrase is available")
+			}
+			passphrase := enc.Passphrase()
+			enc.passphrase = &passphrase
+		}
+		var err error
+		key, err = scrypt.Key([]byte(*enc.passphrase), salt, scryptN, scryptR, scryptP, cacheKeySize)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown key derivation %s", kdf)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
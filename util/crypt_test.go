@@ -0,0 +1,174 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package util
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "portray-crypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyFile, []byte("0123456789abcdef0123456789abcdef"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	otherKeyFile := filepath.Join(dir, "other")
+	if err := ioutil.WriteFile(otherKeyFile, []byte("fedcba9876543210fedcba9876543210"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	passphrase := func(value string) func() string {
+		return func() string { return value }
+	}
+
+	tests := []struct {
+		name    string
+		encrypt *CacheEncryption
+		decrypt *CacheEncryption
+		kdf     string
+		wantErr bool
+	}{
+		{
+			name:    "passphrase",
+			encrypt: &CacheEncryption{Enabled: true, Passphrase: passphrase("correct horse")},
+			decrypt: &CacheEncryption{Passphrase: passphrase("correct horse")},
+			kdf:     "scrypt",
+		},
+		{
+			name:    "key file",
+			encrypt: &CacheEncryption{Enabled: true, KeyFile: keyFile},
+			decrypt: &CacheEncryption{KeyFile: keyFile},
+			kdf:     "keyfile",
+		},
+		{
+			name:    "wrong passphrase",
+			encrypt: &CacheEncryption{Enabled: true, Passphrase: passphrase("correct horse")},
+			decrypt: &CacheEncryption{Passphrase: passphrase("battery staple")},
+			kdf:     "scrypt",
+			wantErr: true,
+		},
+		{
+			name:    "wrong key file",
+			encrypt: &CacheEncryption{Enabled: true, KeyFile: keyFile},
+			decrypt: &CacheEncryption{KeyFile: otherKeyFile},
+			kdf:     "keyfile",
+			wantErr: true,
+		},
+		{
+			name:    "no key file",
+			encrypt: &CacheEncryption{Enabled: true, KeyFile: keyFile},
+			decrypt: &CacheEncryption{Passphrase: passphrase("correct horse")},
+			kdf:     "keyfile",
+			wantErr: true,
+		},
+	}
+
+	plaintext := []byte(`{"AccessKeyID":"ASIAEXAMPLE","SecretAccessKey":"secret"}`)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := test.encrypt.Encrypt(plaintext)
+			if err != nil {
+				t.Fatalf("Encrypt failed: %s", err)
+			}
+			if !IsEncrypted(data) {
+				t.Errorf("IsEncrypted(%s) = false", data)
+			}
+			var envelope encryptedSession
+			if err := json.Unmarshal(data, &envelope); err != nil {
+				t.Fatal(err)
+			}
+			if envelope.Kdf != test.kdf {
+				t.Errorf("Kdf = %q, want %q", envelope.Kdf, test.kdf)
+			}
+
+			got, err := test.decrypt.Decrypt(data)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("Decrypt = %s, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decrypt failed: %s", err)
+			}
+			if string(got) != string(plaintext) {
+				t.Errorf("Decrypt = %s, want %s", got, plaintext)
+			}
+		})
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	dir, err := ioutil.TempDir("", "portray-crypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyFile, []byte("0123456789abcdef0123456789abcdef"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	enc := &CacheEncryption{Enabled: true, KeyFile: keyFile}
+
+	data, err := enc.Encrypt([]byte(`{"AccessKeyID":"ASIAEXAMPLE"}`))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %s", err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(envelope *encryptedSession)
+	}{
+		{"ciphertext", func(envelope *encryptedSession) { envelope.Ciphertext[0] ^= 1 }},
+		{"tag", func(envelope *encryptedSession) { envelope.Ciphertext[len(envelope.Ciphertext)-1] ^= 1 }},
+		{"nonce", func(envelope *encryptedSession) { envelope.Nonce[0] ^= 1 }},
+		{"salt", func(envelope *encryptedSession) { envelope.Salt[0] ^= 1 }},
+		{"truncated", func(envelope *encryptedSession) { envelope.Ciphertext = envelope.Ciphertext[:4] }},
+		{"version", func(envelope *encryptedSession) { envelope.Version = 2 }},
+		{"kdf", func(envelope *encryptedSession) { envelope.Kdf = "none" }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var envelope encryptedSession
+			if err := json.Unmarshal(data, &envelope); err != nil {
+				t.Fatal(err)
+			}
+			test.tamper(&envelope)
+			tampered, err := json.Marshal(envelope)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, err := enc.Decrypt(tampered); err == nil {
+				t.Errorf("Decrypt = %s, want an error", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+const (
+	// EksTokenPrefix is the prefix EKS expects of bearer tokens
+	EksTokenPrefix = "k8s-aws-v1."
+
+	// ExecCredentialApiVersion is the client.authentication.k8s.io version
+	// of the ExecCredential printed for kubectl
+	ExecCredentialApiVersion = "client.authentication.k8s.io/v1beta1"
+
+	// eksClusterHeader names the cluster a token is for in the signed request
+	eksClusterHeader = "x-k8s-aws-id"
+
+	// EKS accepts a presigned request for 15 minutes after it's signed.
+	// Clients are told the token expires a minute earlier, to allow for
+	// clock skew.
+	eksPresignExpiry = 60 * time.Second
+	eksTokenLifetime = 14 * time.Minute
+)
+
+// ExecCredential is the JSON document kubectl expects from an exec
+// credential plugin
+type ExecCredential struct {
+	Kind       string               `json:"kind"`
+	ApiVersion string               `json:"apiVersion"`
+	Spec       struct{}             `json:"spec"`
+	Status     ExecCredentialStatus `json:"status"`
+}
+
+// ExecCredentialStatus holds the token of an ExecCredential
+type ExecCredentialStatus struct {
+	ExpirationTimestamp string `json:"expirationTimestamp"`
+	Token               string `json:"token"`
+}
+
+// EksToken returns a token for an EKS cluster, which is a presigned
+// sts:GetCallerIdentity request that EKS makes to find out who the session
+// belongs to, along with when the token expires.
+func EksToken(awsCreds AwsCreds, cluster string, endpoint StsEndpoint) (token string, expiration time.Time, err error) {
+	stsUrl, signingRegion, err := endpoint.Url()
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(stsUrl, "/")+"/?Action=GetCallerIdentity&Version=2011-06-15", nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set(eksClusterHeader, cluster)
+
+	signer := v4.NewSigner(credentials.NewStaticCredentials(
+		awsCreds.AccessKeyID,
+		awsCreds.SecretAccessKey,
+		awsCreds.SessionToken))
+	now := time.Now()
+	if _, err = signer.Presign(req, nil, "sts", signingRegion, eksPresignExpiry, now); err != nil {
+		return
+	}
+
+	token = EksTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(req.URL.String()))
+	expiration = now.Add(eksTokenLifetime)
+	if awsCreds.Expiration != 0 && time.Unix(awsCreds.Expiration, 0).Before(expiration) {
+		expiration = time.Unix(awsCreds.Expiration, 0)
+	}
+	return
+}
+
+// NewExecCredential returns the ExecCredential of an EKS token.
+func NewExecCredential(token string, expiration time.Time, apiVersion string) ExecCredential {
+	return ExecCredential{
+		Kind:       "ExecCredential",
+		ApiVersion: apiVersion,
+		Status: ExecCredentialStatus{
+			ExpirationTimestamp: expiration.UTC().Format(time.RFC3339),
+			Token:               token,
+		},
+	}
+}
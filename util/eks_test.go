@@ -0,0 +1,118 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeEksToken returns the presigned URL in an EKS token.
+func decodeEksToken(t *testing.T, token string) *url.URL {
+	if !strings.HasPrefix(token, EksTokenPrefix) {
+		t.Fatalf("token %q doesn't start with %s", token, EksTokenPrefix)
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, EksTokenPrefix))
+	if err != nil {
+		t.Fatalf("token isn't base64url: %s", err)
+	}
+	presigned, err := url.Parse(string(decoded))
+	if err != nil {
+		t.Fatalf("token isn't a URL: %s", err)
+	}
+	return presigned
+}
+
+func TestEksToken(t *testing.T) {
+	awsCreds := AwsCreds{AccessKeyID: "ASIAEXAMPLE", SecretAccessKey: "secret", SessionToken: "token", Expiration: time.Now().Add(time.Hour).Unix()}
+
+	tests := []struct {
+		name       string
+		endpoint   StsEndpoint
+		wantHost   string
+		wantRegion string
+	}{
+		{"global", StsEndpoint{Region: "us-east-1"}, "sts.amazonaws.com", "us-east-1"},
+		{"regional", StsEndpoint{Region: "eu-west-1", RegionalEndpoints: "regional"}, "sts.eu-west-1.amazonaws.com", "eu-west-1"},
+		{"China", StsEndpoint{Partition: "aws-cn"}, "sts.cn-north-1.amazonaws.com.cn", "cn-north-1"},
+		{"endpoint url", StsEndpoint{Region: "eu-west-1", EndpointUrl: "https://vpce-1234.sts.eu-west-1.vpce.amazonaws.com/"}, "vpce-1234.sts.eu-west-1.vpce.amazonaws.com", "eu-west-1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, expiration, err := EksToken(awsCreds, "prod", test.endpoint)
+			if err != nil {
+				t.Fatalf("EksToken failed: %s", err)
+			}
+			presigned := decodeEksToken(t, token)
+			query := presigned.Query()
+
+			if presigned.Host != test.wantHost {
+				t.Errorf("host = %q, want %q", presigned.Host, test.wantHost)
+			}
+			if query.Get("Action") != "GetCallerIdentity" || query.Get("Version") != "2011-06-15" {
+				t.Errorf("request = %s, want GetCallerIdentity", presigned)
+			}
+			if query.Get("X-Amz-Expires") != "60" {
+				t.Errorf("X-Amz-Expires = %q, want 60", query.Get("X-Amz-Expires"))
+			}
+			if !strings.Contains(query.Get("X-Amz-SignedHeaders"), eksClusterHeader) {
+				t.Errorf("X-Amz-SignedHeaders = %q, want it to include %s", query.Get("X-Amz-SignedHeaders"), eksClusterHeader)
+			}
+			if !strings.Contains(query.Get("X-Amz-Credential"), "/"+test.wantRegion+"/sts/") {
+				t.Errorf("X-Amz-Credential = %q, want it signed for %s", query.Get("X-Amz-Credential"), test.wantRegion)
+			}
+			if query.Get("X-Amz-Security-Token") != "token" {
+				t.Errorf("X-Amz-Security-Token = %q, want the session token", query.Get("X-Amz-Security-Token"))
+			}
+			if remaining := time.Until(expiration); remaining < 13*time.Minute || remaining > eksTokenLifetime {
+				t.Errorf("token expires in %v, want %v", remaining, eksTokenLifetime)
+			}
+		})
+	}
+
+	// tokens don't outlive the session they're signed with
+	ending := awsCreds
+	ending.Expiration = time.Now().Add(5 * time.Minute).Unix()
+	_, expiration, err := EksToken(ending, "prod", StsEndpoint{})
+	if err != nil {
+		t.Fatalf("EksToken failed: %s", err)
+	}
+	if expiration.Unix() != ending.Expiration {
+		t.Errorf("token expires at %v, want the session expiration %v", expiration, time.Unix(ending.Expiration, 0))
+	}
+}
+
+func TestNewExecCredential(t *testing.T) {
+	expiration := time.Date(2023, 11, 14, 22, 13, 20, 0, time.FixedZone("CET", 3600))
+	output, err := json.Marshal(NewExecCredential("k8s-aws-v1.token", expiration, ExecCredentialApiVersion))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1beta1","spec":{},"status":{"expirationTimestamp":"2023-11-14T21:13:20Z","token":"k8s-aws-v1.token"}}`
+	if string(output) != want {
+		t.Errorf("ExecCredential = %s, want %s", output, want)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+// defaultRegions are the regions STS is called in for each partition when a
+// profile has none
+var defaultRegions = map[string]string{
+	"aws":        "us-east-1",
+	"aws-cn":     "cn-north-1",
+	"aws-us-gov": "us-gov-west-1",
+}
+
+// DefaultRegion returns the region STS is called in when a profile in a
+// partition has none, us-east-1 for unknown partitions.
+func DefaultRegion(partition string) string {
+	if region, ok := defaultRegions[partition]; ok {
+		return region
+	}
+	return defaultRegions["aws"]
+}
+
+// StsEndpoint describes where the STS requests for a profile are sent
+type StsEndpoint struct {
+	Region string
+
+	// RegionalEndpoints is the sts_regional_endpoints setting of the AWS
+	// CLI. When it's "regional", STS is called in Region instead of at the
+	// global endpoint.
+	RegionalEndpoints string
+
+	// EndpointUrl overrides the STS endpoint, e.g. for VPC endpoints, FIPS
+	// and dualstack endpoints, or LocalStack.
+	EndpointUrl string
+
+	// Partition is the partition of the profile's ARN, such as "aws-cn",
+	// which picks the region when Region isn't set.
+	Partition string
+}
+
+// Config returns the SDK config for calling STS at the endpoint.
+func (endpoint StsEndpoint) Config() *aws.Config {
+	region := endpoint.Region
+	if region == "" {
+		region = DefaultRegion(endpoint.Partition)
+	}
+
+	config := &aws.Config{Region: aws.String(region)}
+	if endpoint.EndpointUrl != "" {
+		config.Endpoint = aws.String(endpoint.EndpointUrl)
+	} else if endpoint.RegionalEndpoints == "regional" {
+		config.Endpoint = aws.String("https://sts." + region + "." + dnsSuffix(region))
+	}
+
+	return config
+}
+
+// Url returns the URL of the STS endpoint, and the region requests sent to
+// it are signed for.
+func (endpoint StsEndpoint) Url() (string, string, error) {
+	config := endpoint.Config()
+	if config.Endpoint != nil {
+		return *config.Endpoint, *config.Region, nil
+	}
+
+	resolved, err := endpoints.DefaultResolver().EndpointFor("sts", *config.Region)
+	if err != nil {
+		return "", "", err
+	}
+	signingRegion := resolved.SigningRegion
+	if signingRegion == "" {
+		signingRegion = *config.Region
+	}
+	return resolved.URL, signingRegion, nil
+}
+
+// dnsSuffix returns the domain of the AWS endpoints in a region.
+func dnsSuffix(region string) string {
+	if PartitionForRegion(region) == "aws-cn" {
+		return "amazonaws.com.cn"
+	}
+	return "amazonaws.com"
+}
@@ -0,0 +1,56 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import "testing"
+
+func TestStsEndpointConfig(t *testing.T) {
+	tests := []struct {
+		name         string
+		endpoint     StsEndpoint
+		wantRegion   string
+		wantEndpoint string
+	}{
+		{"default", StsEndpoint{}, "us-east-1", ""},
+		{"region", StsEndpoint{Region: "eu-west-1", Partition: "aws"}, "eu-west-1", ""},
+		{"China", StsEndpoint{Partition: "aws-cn"}, "cn-north-1", ""},
+		{"GovCloud", StsEndpoint{Partition: "aws-us-gov"}, "us-gov-west-1", ""},
+		{"unknown partition", StsEndpoint{Partition: "aws-iso"}, "us-east-1", ""},
+		{"regional", StsEndpoint{Region: "eu-west-1", RegionalEndpoints: "regional"}, "eu-west-1", "https://sts.eu-west-1.amazonaws.com"},
+		{"regional China", StsEndpoint{Partition: "aws-cn", RegionalEndpoints: "regional"}, "cn-north-1", "https://sts.cn-north-1.amazonaws.com.cn"},
+		{"endpoint url", StsEndpoint{Region: "eu-west-1", RegionalEndpoints: "regional", EndpointUrl: "http://localhost:4566"}, "eu-west-1", "http://localhost:4566"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := test.endpoint.Config()
+			if *config.Region != test.wantRegion {
+				t.Errorf("Region = %q, want %q", *config.Region, test.wantRegion)
+			}
+			var endpoint string
+			if config.Endpoint != nil {
+				endpoint = *config.Endpoint
+			}
+			if endpoint != test.wantEndpoint {
+				t.Errorf("Endpoint = %q, want %q", endpoint, test.wantEndpoint)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// RunCommand runs a command as a child process with the given environment and
+// returns its exit code. Signals are relayed to the child with a
+// signalRelay, so it can handle them itself.
+func RunCommand(name string, args []string, env []string) int {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = env
+
+	signals := catchSignals(interruptSignals)
+	defer signals.stop()
+
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 127
+	}
+	signals.relay(cmd.Process)
+
+	err := cmd.Wait()
+
+	return exitCode(err)
+}
+
+// signalRelay forwards the signals sent to portray alone to a child
+// process, while those from the terminal, which the child receives itself
+// as part of the foreground process group, are ignored so it doesn't get
+// them twice
+type signalRelay struct {
+	ignored   chan os.Signal
+	forwarded chan os.Signal
+	done      chan struct{}
+}
+
+// catchSignals starts catching signals, ignoring those in ignored, before the
+// child is started so none of them stop portray in the meantime.
+func catchSignals(ignored []os.Signal) *signalRelay {
+	relay := &signalRelay{
+		ignored:   make(chan os.Signal, 1),
+		forwarded: make(chan os.Signal, 1),
+		done:      make(chan struct{}),
+	}
+	signal.Notify(relay.ignored, ignored...)
+	signal.Notify(relay.forwarded, syscall.SIGTERM, syscall.SIGHUP)
+	return relay
+}
+
+// relay forwards the signals caught to the child until stop is called.
+func (relay *signalRelay) relay(process *os.Process) {
+	go func() {
+		for {
+			select {
+			case <-relay.ignored:
+			case sig := <-relay.forwarded:
+				process.Signal(sig)
+			case <-relay.done:
+				return
+			}
+		}
+	}()
+}
+
+// stop stops catching signals.
+func (relay *signalRelay) stop() {
+	signal.Stop(relay.ignored)
+	signal.Stop(relay.forwarded)
+	close(relay.done)
+}
+
+// exitCode converts the error returned by exec.Cmd.Wait into a shell style
+// exit code, using 128+n for children killed by signal n.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			if status.Signaled() {
+				return 128 + int(status.Signal())
+			}
+			return status.ExitStatus()
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, err.Error())
+	return 1
+}
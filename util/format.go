@@ -0,0 +1,135 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EnvFormats lists the output formats supported by FormatEnv
+var EnvFormats = []string{"bash", "zsh", "sh", "fish", "powershell", "cmd", "dotenv", "docker"}
+
+// FormatEnv renders environment variables as statements for the given shell,
+// or as a dotenv or Docker --env-file file. Variables can't be unset in
+// dotenv and Docker files, so they're left out. Neither Docker files nor cmd
+// can hold values with newlines, so those are an error.
+func FormatEnv(vars []EnvVar, format string) (string, error) {
+	if !validFormat(format) {
+		return "", fmt.Errorf("Unknown format %s! Valid values are %s", format, strings.Join(EnvFormats, ", "))
+	}
+
+	var lines []string
+
+	for _, v := range vars {
+		var line string
+
+		if (format == "docker" || format == "cmd") && strings.ContainsAny(v.Value, "\r\n") {
+			return "", fmt.Errorf("Unable to write %s in the %s format, since its value has a line break", v.Name, format)
+		}
+
+		if v.Unset {
+			switch format {
+			case "bash", "zsh", "sh":
+				lines = append(lines, "unset "+v.Name)
+			case "fish":
+				lines = append(lines, "set -e "+v.Name)
+			case "powershell":
+				lines = append(lines, "Remove-Item Env:"+v.Name+" -ErrorAction SilentlyContinue")
+			case "cmd":
+				lines = append(lines, `set "`+v.Name+`="`)
+			}
+			continue
+		}
+
+		switch format {
+		case "bash", "zsh", "sh":
+			line = "export " + v.Name + "=" + shellQuote(v.Value)
+		case "fish":
+			line = "set -gx " + v.Name + " " + fishQuote(v.Value)
+		case "powershell":
+			line = "$Env:" + v.Name + " = '" + strings.Replace(v.Value, "'", "''", -1) + "'"
+		case "cmd":
+			line = `set "` + v.Name + "=" + v.Value + `"`
+		case "dotenv":
+			line = v.Name + "=" + dotenvQuote(v.Value)
+		case "docker":
+			// Docker reads env files literally, so values can't be quoted
+			line = v.Name + "=" + v.Value
+		}
+
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// validFormat tells if format is one of the EnvFormats
+func validFormat(format string) bool {
+	for _, f := range EnvFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// shellQuote wraps a value in single quotes for POSIX shells.
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+// fishQuote wraps a value in single quotes for fish, which only treats
+// backslashes and single quotes specially inside them.
+func fishQuote(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, "'", `\'`, -1)
+	return "'" + value + "'"
+}
+
+// dotenvQuote wraps a value in double quotes for dotenv files.
+func dotenvQuote(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	value = strings.Replace(value, "\n", `\n`, -1)
+	return `"` + value + `"`
+}
+
+// ProcessCredentials is the JSON document the AWS SDKs and CLI expect from a
+// credential_process command
+type ProcessCredentials struct {
+	Version         int
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      string
+}
+
+// NewProcessCredentials converts a session to the credential_process format.
+func NewProcessCredentials(awsCreds AwsCreds) ProcessCredentials {
+	return ProcessCredentials{
+		Version:         1,
+		AccessKeyId:     awsCreds.AccessKeyID,
+		SecretAccessKey: awsCreds.SecretAccessKey,
+		SessionToken:    awsCreds.SessionToken,
+		Expiration:      time.Unix(awsCreds.Expiration, 0).UTC().Format(time.RFC3339),
+	}
+}
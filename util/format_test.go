@@ -0,0 +1,102 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package util
+
+import "testing"
+
+func TestFormatEnv(t *testing.T) {
+	value := "it's \"$HOME\"\nnext"
+	vars := []EnvVar{
+		{Name: "VALUE", Value: value},
+		{Name: "GONE", Unset: true},
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"bash", "export VALUE='it'\\''s \"$HOME\"\nnext'\nunset GONE\n"},
+		{"zsh", "export VALUE='it'\\''s \"$HOME\"\nnext'\nunset GONE\n"},
+		{"sh", "export VALUE='it'\\''s \"$HOME\"\nnext'\nunset GONE\n"},
+		{"fish", "set -gx VALUE 'it\\'s \"$HOME\"\nnext'\nset -e GONE\n"},
+		{"powershell", "$Env:VALUE = 'it''s \"$HOME\"\nnext'\nRemove-Item Env:GONE -ErrorAction SilentlyContinue\n"},
+		{"dotenv", "VALUE=\"it's \\\"$HOME\\\"\\nnext\"\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			got, err := FormatEnv(vars, test.format)
+			if err != nil {
+				t.Fatalf("FormatEnv failed: %s", err)
+			}
+			if got != test.want {
+				t.Errorf("FormatEnv(%s) = %q, want %q", test.format, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFormatEnvLiteral(t *testing.T) {
+	vars := []EnvVar{
+		{Name: "VALUE", Value: `it's "$HOME"`},
+		{Name: "GONE", Unset: true},
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"cmd", "set \"VALUE=it's \"$HOME\"\"\nset \"GONE=\"\n"},
+		{"docker", "VALUE=it's \"$HOME\"\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			got, err := FormatEnv(vars, test.format)
+			if err != nil {
+				t.Fatalf("FormatEnv failed: %s", err)
+			}
+			if got != test.want {
+				t.Errorf("FormatEnv(%s) = %q, want %q", test.format, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFormatEnvErrors(t *testing.T) {
+	tests := []struct {
+		format string
+		value  string
+	}{
+		{"csh", "value"},
+		{"pwsh", "value"},
+		{"docker", "first\nsecond"},
+		{"cmd", "first\r\nsecond"},
+	}
+
+	for _, test := range tests {
+		if _, err := FormatEnv([]EnvVar{{Name: "A", Value: test.value}}, test.format); err == nil {
+			t.Errorf("FormatEnv(%s) of %q succeeded, want an error", test.format, test.value)
+		}
+	}
+
+	if _, err := FormatEnv([]EnvVar{{Name: "A", Unset: true}}, "pwsh"); err == nil {
+		t.Error("FormatEnv(pwsh) of an unset variable succeeded, want an error")
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// CallerIdentity is the principal a set of credentials belongs to
+type CallerIdentity struct {
+	Arn     string
+	Account string
+	UserId  string
+}
+
+// GetCallerIdentity asks STS which principal a session belongs to.
+func GetCallerIdentity(awsCreds AwsCreds, endpoint StsEndpoint) (identity CallerIdentity, err error) {
+	config := endpoint.Config()
+	config.Credentials = credentials.NewStaticCredentials(
+		awsCreds.AccessKeyID,
+		awsCreds.SecretAccessKey,
+		awsCreds.SessionToken)
+
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return
+	}
+	svc := sts.New(sess)
+
+	resp, err := svc.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return
+	}
+
+	identity = CallerIdentity{
+		Arn:     *resp.Arn,
+		Account: *resp.Account,
+		UserId:  *resp.UserId,
+	}
+	return
+}
@@ -0,0 +1,113 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"os"
+)
+
+// FileLock is an advisory lock held on a lock file
+type FileLock struct {
+	file *os.File
+}
+
+// LockFile takes an exclusive advisory lock on a lock file, creating it if
+// needed. If another process holds the lock, waiting is called before
+// blocking until that process releases it.
+func LockFile(path string, waiting func()) (*FileLock, error) {
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := tryLock(file); err != nil {
+			if waiting != nil {
+				waiting()
+				waiting = nil
+			}
+			if err := lock(file); err != nil {
+				file.Close()
+				return nil, err
+			}
+		}
+
+		// RemoveLockFile may have deleted the file while we waited for the
+		// lock, so the lock only counts if it's still on the file at path
+		if lockedPath(file, path) {
+			return &FileLock{file}, nil
+		}
+		unlock(file)
+		file.Close()
+	}
+}
+
+// lockedPath tells if a locked file is still the file at path.
+func lockedPath(file *os.File, path string) bool {
+	locked, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(locked, current)
+}
+
+// Unlock releases the lock.
+func (fileLock *FileLock) Unlock() error {
+	defer fileLock.file.Close()
+	return unlock(fileLock.file)
+}
+
+// RemoveLockFile deletes a lock file, unless another process holds the lock.
+// The file is deleted while it's locked, so processes waiting for the lock
+// see it's gone and lock a new one. Where locked files can't be deleted, lock
+// files are left in place.
+func RemoveLockFile(path string) error {
+	if !removableLockFiles {
+		return nil
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := tryLock(file); err != nil {
+		return nil
+	}
+	defer unlock(file)
+
+	// another process may have deleted and recreated it before we locked it
+	if !lockedPath(file, path) {
+		return nil
+	}
+
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,151 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// lockAsync takes a lock in the background, sending it once it's held and
+// closing waited when LockFile starts waiting.
+func lockAsync(t *testing.T, path string) (chan *FileLock, chan struct{}) {
+	locked := make(chan *FileLock, 1)
+	waited := make(chan struct{})
+	go func() {
+		fileLock, err := LockFile(path, func() { close(waited) })
+		if err != nil {
+			t.Errorf("LockFile failed: %s", err)
+		}
+		locked <- fileLock
+	}()
+	return locked, waited
+}
+
+func TestLockFile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "portray-session-dev.lock")
+
+	first, err := LockFile(path, func() { t.Error("LockFile waited for a free lock") })
+	if err != nil {
+		t.Fatalf("LockFile failed: %s", err)
+	}
+
+	locked, waited := lockAsync(t, path)
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("LockFile didn't wait for a held lock")
+	}
+	select {
+	case <-locked:
+		t.Fatal("LockFile took a held lock")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := first.Unlock(); err != nil {
+		t.Fatalf("Unlock failed: %s", err)
+	}
+	select {
+	case second := <-locked:
+		second.Unlock()
+	case <-time.After(5 * time.Second):
+		t.Fatal("LockFile didn't take the released lock")
+	}
+}
+
+func TestRemoveLockFile(t *testing.T) {
+	if !removableLockFiles {
+		t.Skip("lock files can't be removed while they're locked")
+	}
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "portray-session-dev.lock")
+
+	if err := RemoveLockFile(path); err != nil {
+		t.Errorf("RemoveLockFile of a missing file failed: %s", err)
+	}
+
+	fileLock, err := LockFile(path, nil)
+	if err != nil {
+		t.Fatalf("LockFile failed: %s", err)
+	}
+	if err := RemoveLockFile(path); err != nil {
+		t.Fatalf("RemoveLockFile failed: %s", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("RemoveLockFile removed a held lock file: %s", err)
+	}
+
+	fileLock.Unlock()
+	if err := RemoveLockFile(path); err != nil {
+		t.Fatalf("RemoveLockFile failed: %s", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("RemoveLockFile left a free lock file: %v", err)
+	}
+}
+
+func TestLockFileRemovedWhileWaiting(t *testing.T) {
+	if !removableLockFiles {
+		t.Skip("lock files can't be removed while they're locked")
+	}
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "portray-session-dev.lock")
+
+	first, err := LockFile(path, nil)
+	if err != nil {
+		t.Fatalf("LockFile failed: %s", err)
+	}
+	locked, waited := lockAsync(t, path)
+	<-waited
+
+	// the lock file is deleted while it's held, as RemoveLockFile does
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	first.Unlock()
+
+	var second *FileLock
+	select {
+	case second = <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("LockFile didn't take the lock")
+	}
+	defer second.Unlock()
+
+	// the waiting process must hold the lock of the new file at path, so a
+	// third one can't take it as well
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("LockFile didn't recreate the lock file: %s", err)
+	}
+	third, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer third.Close()
+	if err := tryLock(third); err == nil {
+		t.Error("the lock file at path isn't locked")
+	}
+}
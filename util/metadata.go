@@ -0,0 +1,219 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	metadataTokenPath      = "/latest/api/token"
+	metadataTokenHeader    = "X-aws-ec2-metadata-token"
+	metadataTokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	metadataCredsPath      = "/latest/meta-data/iam/security-credentials"
+
+	// maxMetadataTokenTTL is the longest an IMDSv2 token can live, as on EC2
+	maxMetadataTokenTTL = 6 * time.Hour
+)
+
+// MetadataCredentials is the JSON document the EC2 instance metadata service
+// returns for the credentials of an instance role
+type MetadataCredentials struct {
+	Code            string
+	LastUpdated     string
+	Type            string
+	AccessKeyId     string
+	SecretAccessKey string
+	Token           string
+	Expiration      string
+}
+
+// MetadataHandler emulates the parts of the EC2 instance metadata service
+// that SDKs use to find the credentials and region of an instance, serving
+// the session returned by its load function as the instance role. Both
+// IMDSv1 and IMDSv2 requests are accepted unless RequireToken is set.
+type MetadataHandler struct {
+	RequireToken bool
+
+	mutex  sync.Mutex
+	info   SessionInfo
+	load   func() (AwsCreds, error)
+	tokens map[string]time.Time
+
+	// loadMutex serializes calls to load, so it's free to refresh the session
+	loadMutex sync.Mutex
+}
+
+// NewMetadataHandler returns a MetadataHandler serving the session of a
+// profile.
+func NewMetadataHandler(info SessionInfo, load func() (AwsCreds, error)) *MetadataHandler {
+	handler := &MetadataHandler{tokens: map[string]time.Time{}}
+	handler.SetSession(info, load)
+	return handler
+}
+
+// SetSession swaps the session served, which SDKs pick up the next time
+// they refresh their credentials.
+func (handler *MetadataHandler) SetSession(info SessionInfo, load func() (AwsCreds, error)) {
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+	handler.info = info
+	handler.load = load
+}
+
+// roleName returns the name of the instance role of the session served,
+// which is the profile name for sessions without a role.
+func (info SessionInfo) roleName() string {
+	if info.RoleName != "" {
+		return info.RoleName
+	}
+	return info.Profile
+}
+
+func (handler *MetadataHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == metadataTokenPath {
+		handler.issueToken(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !handler.checkToken(r.Header.Get(metadataTokenHeader)) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	handler.mutex.Lock()
+	info, load := handler.info, handler.load
+	handler.mutex.Unlock()
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case path == metadataCredsPath:
+		fmt.Fprint(w, info.roleName())
+	case path == metadataCredsPath+"/"+info.roleName():
+		handler.loadMutex.Lock()
+		awsCreds, err := load()
+		handler.loadMutex.Unlock()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to serve credentials: %s\n", err)
+			writeMetadataJSON(w, map[string]string{
+				"Code":        "CredentialsUnavailable",
+				"Message":     err.Error(),
+				"LastUpdated": time.Now().UTC().Format(time.RFC3339),
+			})
+			return
+		}
+		writeMetadataJSON(w, MetadataCredentials{
+			Code:            "Success",
+			LastUpdated:     time.Now().UTC().Format(time.RFC3339),
+			Type:            "AWS-HMAC",
+			AccessKeyId:     awsCreds.AccessKeyID,
+			SecretAccessKey: awsCreds.SecretAccessKey,
+			Token:           awsCreds.SessionToken,
+			Expiration:      time.Unix(awsCreds.Expiration, 0).UTC().Format(time.RFC3339),
+		})
+	case path == "/latest/meta-data/iam/info":
+		writeMetadataJSON(w, map[string]string{
+			"Code":               "Success",
+			"LastUpdated":        time.Now().UTC().Format(time.RFC3339),
+			"InstanceProfileArn": NewIamArn(info.Region, info.AccountId, "instance-profile/"+info.roleName()).String(),
+		})
+	case path == "/latest/meta-data/placement/region" && info.Region != "":
+		fmt.Fprint(w, info.Region)
+	case path == "/latest/dynamic/instance-identity/document":
+		writeMetadataJSON(w, map[string]string{
+			"accountId": info.AccountId,
+			"region":    info.Region,
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// issueToken hands out an IMDSv2 session token for the TTL requested, which
+// must be sent with later requests. As on EC2, requests that went through a
+// proxy are refused.
+func (handler *MetadataHandler) issueToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get("X-Forwarded-For") != "" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	seconds, err := strconv.Atoi(r.Header.Get(metadataTokenTTLHeader))
+	ttl := time.Duration(seconds) * time.Second
+	if err != nil || ttl <= 0 || ttl > maxMetadataTokenTTL {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	id := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	token := hex.EncodeToString(id)
+
+	handler.mutex.Lock()
+	now := time.Now()
+	for t, expiration := range handler.tokens {
+		if now.After(expiration) {
+			delete(handler.tokens, t)
+		}
+	}
+	handler.tokens[token] = now.Add(ttl)
+	handler.mutex.Unlock()
+
+	w.Header().Set(metadataTokenTTLHeader, strconv.Itoa(seconds))
+	fmt.Fprint(w, token)
+}
+
+// checkToken reports whether a request with the given IMDSv2 token, which
+// is empty for IMDSv1 requests, may be answered.
+func (handler *MetadataHandler) checkToken(token string) bool {
+	if token == "" {
+		return !handler.RequireToken
+	}
+
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+	expiration, ok := handler.tokens[token]
+	return ok && time.Now().Before(expiration)
+}
+
+func writeMetadataJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,166 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// metadataRequest sends a request to a MetadataHandler, returning the status
+// and body of the response.
+func metadataRequest(t *testing.T, handler http.Handler, method string, path string, headers map[string]string) (int, string) {
+	req := httptest.NewRequest(method, path, nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	body, err := ioutil.ReadAll(w.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, string(body)
+}
+
+func TestMetadataToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{"issued", http.MethodPut, map[string]string{metadataTokenTTLHeader: "21600"}, http.StatusOK},
+		{"GET", http.MethodGet, map[string]string{metadataTokenTTLHeader: "60"}, http.StatusMethodNotAllowed},
+		{"no TTL", http.MethodPut, nil, http.StatusBadRequest},
+		{"zero TTL", http.MethodPut, map[string]string{metadataTokenTTLHeader: "0"}, http.StatusBadRequest},
+		{"TTL too long", http.MethodPut, map[string]string{metadataTokenTTLHeader: "21601"}, http.StatusBadRequest},
+		{"proxied", http.MethodPut, map[string]string{metadataTokenTTLHeader: "60", "X-Forwarded-For": "10.0.0.1"}, http.StatusForbidden},
+	}
+
+	handler := NewMetadataHandler(SessionInfo{}, nil)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, body := metadataRequest(t, handler, test.method, metadataTokenPath, test.headers)
+			if status != test.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", status, test.wantStatus, body)
+			}
+			if status == http.StatusOK && body == "" {
+				t.Error("no token issued")
+			}
+		})
+	}
+}
+
+func TestMetadataCredentials(t *testing.T) {
+	expiration := time.Now().Add(time.Hour).Unix()
+	load := func() (AwsCreds, error) {
+		return AwsCreds{AccessKeyID: "ASIAEXAMPLE", SecretAccessKey: "secret", SessionToken: "token", Expiration: expiration}, nil
+	}
+	info := SessionInfo{AccountId: "123456789012", RoleName: "Admin", Profile: "DevAdmin", Region: "us-east-1"}
+
+	issue := func(handler http.Handler) string {
+		status, token := metadataRequest(t, handler, http.MethodPut, metadataTokenPath, map[string]string{metadataTokenTTLHeader: "60"})
+		if status != http.StatusOK {
+			t.Fatalf("token status = %d", status)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name         string
+		requireToken bool
+		token        func(handler http.Handler) string
+		wantStatus   int
+	}{
+		{"IMDSv1", false, func(http.Handler) string { return "" }, http.StatusOK},
+		{"IMDSv2", false, issue, http.StatusOK},
+		{"IMDSv2 required", true, issue, http.StatusOK},
+		{"IMDSv1 refused", true, func(http.Handler) string { return "" }, http.StatusUnauthorized},
+		{"unknown token", false, func(http.Handler) string { return "forged" }, http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := NewMetadataHandler(info, load)
+			handler.RequireToken = test.requireToken
+			headers := map[string]string{}
+			if token := test.token(handler); token != "" {
+				headers[metadataTokenHeader] = token
+			}
+
+			status, body := metadataRequest(t, handler, http.MethodGet, metadataCredsPath+"/", headers)
+			if status != test.wantStatus {
+				t.Fatalf("role status = %d, want %d: %s", status, test.wantStatus, body)
+			}
+			if status != http.StatusOK {
+				return
+			}
+			if body != "Admin" {
+				t.Fatalf("role = %q, want Admin", body)
+			}
+
+			status, body = metadataRequest(t, handler, http.MethodGet, metadataCredsPath+"/Admin", headers)
+			if status != http.StatusOK {
+				t.Fatalf("credentials status = %d: %s", status, body)
+			}
+			var creds MetadataCredentials
+			if err := json.Unmarshal([]byte(body), &creds); err != nil {
+				t.Fatal(err)
+			}
+			if creds.Code != "Success" || creds.AccessKeyId != "ASIAEXAMPLE" || creds.Token != "token" {
+				t.Errorf("credentials = %+v", creds)
+			}
+			if creds.Expiration != time.Unix(expiration, 0).UTC().Format(time.RFC3339) {
+				t.Errorf("Expiration = %s", creds.Expiration)
+			}
+		})
+	}
+}
+
+func TestMetadataExpiredToken(t *testing.T) {
+	handler := NewMetadataHandler(SessionInfo{RoleName: "Admin"}, nil)
+	handler.tokens["expired"] = time.Now().Add(-time.Second)
+
+	status, _ := metadataRequest(t, handler, http.MethodGet, metadataCredsPath, map[string]string{metadataTokenHeader: "expired"})
+	if status != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestMetadataLoadError(t *testing.T) {
+	handler := NewMetadataHandler(SessionInfo{RoleName: "Admin"}, func() (AwsCreds, error) {
+		return AwsCreds{}, errors.New("an MFA token is needed")
+	})
+
+	_, body := metadataRequest(t, handler, http.MethodGet, metadataCredsPath+"/Admin", nil)
+	var response map[string]string
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response["Code"] != "CredentialsUnavailable" || response["Message"] != "an MFA token is needed" {
+		t.Errorf("response = %v", response)
+	}
+}
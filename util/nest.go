@@ -0,0 +1,89 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// StackSeparator separates the sessions of nested portray shells in
+// PORTRAY_STACK
+const StackSeparator = " > "
+
+// StackEntry describes a session in PORTRAY_STACK as account:role, with the
+// alias of the account when it has one. Sessions without a role are
+// described by their account alone.
+func (info SessionInfo) StackEntry() string {
+	entry := info.AccountId
+	if info.AccountAlias != "" {
+		entry = info.AccountAlias
+	}
+	if info.RoleName != "" {
+		entry = entry + ":" + info.RoleName
+	}
+	return entry
+}
+
+// ShellDepth returns how many portray shells the current process is
+// running in, from PORTRAY_DEPTH.
+func ShellDepth() int {
+	depth, _ := strconv.Atoi(os.Getenv("PORTRAY_DEPTH"))
+	return depth
+}
+
+// ShellStack returns the sessions of the portray shells the current process
+// is running in, from the outermost to the innermost.
+func ShellStack() []string {
+	stack := os.Getenv("PORTRAY_STACK")
+	if stack == "" {
+		return nil
+	}
+	return strings.Split(stack, StackSeparator)
+}
+
+// NestEnv returns the environment variables that place a new portray shell
+// with a session on top of the stack of shells it's started in.
+func NestEnv(info SessionInfo) ([]EnvVar, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	stack := append(ShellStack(), info.StackEntry())
+	return []EnvVar{
+		{Name: "PORTRAY_DEPTH", Value: strconv.Itoa(ShellDepth() + 1)},
+		{Name: "PORTRAY_SESSION_ID", Value: hex.EncodeToString(id)},
+		{Name: "PORTRAY_STACK", Value: strings.Join(stack, StackSeparator)},
+	}, nil
+}
+
+// EnvCreds returns the session exported to the environment, such as that of
+// the portray shell the current process is running in.
+func EnvCreds() AwsCreds {
+	return AwsCreds{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"os"
+	"testing"
+)
+
+func TestStackEntry(t *testing.T) {
+	tests := []struct {
+		name string
+		info SessionInfo
+		want string
+	}{
+		{"role", SessionInfo{AccountId: "111111111111", RoleName: "Admin", Profile: "hub-admin"}, "111111111111:Admin"},
+		{"alias", SessionInfo{AccountId: "111111111111", AccountAlias: "hub", RoleName: "Admin", Profile: "hub-admin"}, "hub:Admin"},
+		{"no role", SessionInfo{AccountId: "111111111111", Profile: "dev"}, "111111111111"},
+		{"alias without role", SessionInfo{AccountId: "111111111111", AccountAlias: "hub", Profile: "dev"}, "hub"},
+	}
+
+	for _, test := range tests {
+		if got := test.info.StackEntry(); got != test.want {
+			t.Errorf("%s: StackEntry = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestNestEnv(t *testing.T) {
+	defer os.Unsetenv("PORTRAY_DEPTH")
+	defer os.Unsetenv("PORTRAY_STACK")
+
+	tests := []struct {
+		name      string
+		depth     string
+		stack     string
+		wantDepth string
+		wantStack string
+	}{
+		{"outermost", "", "", "1", "spoke:Deploy"},
+		{"nested", "1", "hub:Admin", "2", "hub:Admin > spoke:Deploy"},
+		{"deeper", "2", "hub:Admin > 222222222222:Read", "3", "hub:Admin > 222222222222:Read > spoke:Deploy"},
+	}
+
+	info := SessionInfo{AccountId: "333333333333", AccountAlias: "spoke", RoleName: "Deploy"}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			os.Setenv("PORTRAY_DEPTH", test.depth)
+			os.Setenv("PORTRAY_STACK", test.stack)
+
+			vars, err := NestEnv(info)
+			if err != nil {
+				t.Fatalf("NestEnv failed: %s", err)
+			}
+			values := make(map[string]string)
+			for _, v := range vars {
+				values[v.Name] = v.Value
+			}
+			if values["PORTRAY_DEPTH"] != test.wantDepth {
+				t.Errorf("PORTRAY_DEPTH = %q, want %q", values["PORTRAY_DEPTH"], test.wantDepth)
+			}
+			if values["PORTRAY_STACK"] != test.wantStack {
+				t.Errorf("PORTRAY_STACK = %q, want %q", values["PORTRAY_STACK"], test.wantStack)
+			}
+			if len(values["PORTRAY_SESSION_ID"]) != 16 {
+				t.Errorf("PORTRAY_SESSION_ID = %q, want 16 hex digits", values["PORTRAY_SESSION_ID"])
+			}
+		})
+	}
+}
+
+func TestShellStack(t *testing.T) {
+	defer os.Unsetenv("PORTRAY_STACK")
+
+	os.Setenv("PORTRAY_STACK", "")
+	if stack := ShellStack(); stack != nil {
+		t.Errorf("ShellStack = %q, want none", stack)
+	}
+	os.Setenv("PORTRAY_STACK", "hub:Admin > spoke:Deploy")
+	if stack := ShellStack(); len(stack) != 2 || stack[0] != "hub:Admin" || stack[1] != "spoke:Deploy" {
+		t.Errorf("ShellStack = %q, want [hub:Admin spoke:Deploy]", stack)
+	}
+}
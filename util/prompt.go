@@ -0,0 +1,154 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultPromptTemplate renders the prompt as account:role:profile, in the
+// color of the profile if it has one
+const DefaultPromptTemplate = `{{.Color}}{{.Default}}{{.Reset}}`
+
+// PromptColors maps the PromptColor of a profile to its ANSI color code
+var PromptColors = map[string]string{
+	"black":   "30",
+	"red":     "31",
+	"green":   "32",
+	"yellow":  "33",
+	"blue":    "34",
+	"magenta": "35",
+	"cyan":    "36",
+	"white":   "37",
+}
+
+// escapeSequence matches ANSI escape sequences, such as color codes
+var escapeSequence = regexp.MustCompile(`\x1b(\[[0-9;?]*[ -/]*[@-~]|[@-_])`)
+
+// StripEscapes removes ANSI escape sequences and any other control
+// characters from a rendered prompt.
+func StripEscapes(prompt string) string {
+	prompt = escapeSequence.ReplaceAllString(prompt, "")
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, prompt)
+}
+
+// PromptData is what a PromptTemplate is rendered with
+type PromptData struct {
+	AccountId    string
+	AccountAlias string
+	RoleName     string
+	Profile      string
+	Region       string
+	Environment  string
+
+	// Account is the AccountAlias, or the AccountId if there's no alias
+	Account string
+
+	Expiration time.Time
+	Remaining  time.Duration
+	Expired    bool
+
+	// Color and Reset are the escape codes that start and end the color of
+	// the profile, or empty if it has none
+	Color string
+	Reset string
+
+	// Default is the prompt rendered by default, account:role:profile
+	Default string
+}
+
+// ValidatePrompt checks a prompt template and color.
+func ValidatePrompt(promptTemplate string, promptColor string) error {
+	if _, ok := PromptColors[strings.ToLower(promptColor)]; promptColor != "" && !ok {
+		return fmt.Errorf("Unknown PromptColor %s! Valid values are black, red, green, yellow, blue, magenta, cyan and white", promptColor)
+	}
+	if promptTemplate != "" {
+		if _, err := template.New("prompt").Parse(promptTemplate); err != nil {
+			return fmt.Errorf("Invalid PromptTemplate! %s", err)
+		}
+	}
+	return nil
+}
+
+// RenderPrompt renders the PromptTemplate of a session, or the
+// DefaultPromptTemplate if it has none. For the bash and zsh shells color
+// codes are marked as not taking up space in the prompt.
+func (info SessionInfo) RenderPrompt(expiration int64, shell string) (string, error) {
+	promptTemplate := info.PromptTemplate
+	if promptTemplate == "" {
+		promptTemplate = DefaultPromptTemplate
+	}
+	tmpl, err := template.New("prompt").Parse(promptTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	data := PromptData{
+		AccountId:    info.AccountId,
+		AccountAlias: info.AccountAlias,
+		RoleName:     info.RoleName,
+		Profile:      info.Profile,
+		Region:       info.Region,
+		Environment:  info.Environment,
+		Account:      info.AccountId,
+		Default:      info.Prompt(),
+	}
+	if info.AccountAlias != "" {
+		data.Account = info.AccountAlias
+	}
+	if expiration != 0 {
+		data.Expiration = time.Unix(expiration, 0)
+		data.Remaining = Round(data.Expiration.Sub(time.Now()), time.Second)
+		if data.Remaining < 0 {
+			data.Remaining = 0
+		}
+		data.Expired = data.Remaining == 0
+	}
+	if code, ok := PromptColors[strings.ToLower(info.PromptColor)]; ok {
+		data.Color = "\x1b[" + code + "m"
+		data.Reset = "\x1b[0m"
+		switch shell {
+		case "bash":
+			// readline's markers, since bash doesn't interpret \[ and \]
+			// in the output of commands
+			data.Color = "\x01" + data.Color + "\x02"
+			data.Reset = "\x01" + data.Reset + "\x02"
+		case "zsh":
+			data.Color = "%{" + data.Color + "%}"
+			data.Reset = "%{" + data.Reset + "%}"
+		}
+	}
+
+	var prompt bytes.Buffer
+	if err := tmpl.Execute(&prompt, data); err != nil {
+		return "", err
+	}
+	return prompt.String(), nil
+}
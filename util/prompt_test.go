@@ -0,0 +1,115 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRenderPrompt(t *testing.T) {
+	info := SessionInfo{
+		AccountId:    "111111111111",
+		AccountAlias: "hub",
+		RoleName:     "Admin",
+		Profile:      "HubAdmin",
+		Region:       "eu-west-1",
+		Environment:  "prod",
+	}
+	colored := info
+	colored.PromptColor = "Red"
+	chained := info
+	chained.Chain = []string{"222222222222:Read", "111111111111:Admin"}
+	expiration := time.Now().Add(90 * time.Minute).Unix()
+
+	tests := []struct {
+		name     string
+		info     SessionInfo
+		template string
+		shell    string
+		want     string
+	}{
+		{"default", info, "", "", "111111111111:Admin:HubAdmin"},
+		{"chain", chained, "", "", "222222222222:Read > 111111111111:Admin:HubAdmin"},
+		{"color", colored, "", "", "\x1b[31m111111111111:Admin:HubAdmin\x1b[0m"},
+		{"bash color", colored, "", "bash", "\x01\x1b[31m\x02111111111111:Admin:HubAdmin\x01\x1b[0m\x02"},
+		{"zsh color", colored, "", "zsh", "%{\x1b[31m%}111111111111:Admin:HubAdmin%{\x1b[0m%}"},
+		{"fields", info, "{{.Account}}/{{.RoleName}} {{.Environment}} {{.Region}}", "", "hub/Admin prod eu-west-1"},
+		{"expiration", info, "{{if not .Expired}}{{.Expiration.Unix}}{{end}}", "", strconv.FormatInt(expiration, 10)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.info.PromptTemplate = test.template
+			got, err := test.info.RenderPrompt(expiration, test.shell)
+			if err != nil {
+				t.Fatalf("RenderPrompt failed: %s", err)
+			}
+			if got != test.want {
+				t.Errorf("RenderPrompt = %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	expired, err := SessionInfo{PromptTemplate: "{{.Expired}} {{.Remaining}}"}.RenderPrompt(time.Now().Add(-time.Minute).Unix(), "")
+	if err != nil || expired != "true 0s" {
+		t.Errorf("RenderPrompt of an expired session = %q, %v, want \"true 0s\"", expired, err)
+	}
+}
+
+func TestValidatePrompt(t *testing.T) {
+	tests := []struct {
+		template string
+		color    string
+		wantErr  bool
+	}{
+		{"", "", false},
+		{"{{.Account}}", "Green", false},
+		{"", "purple", true},
+		{"{{.Account", "", true},
+	}
+
+	for _, test := range tests {
+		if err := ValidatePrompt(test.template, test.color); (err != nil) != test.wantErr {
+			t.Errorf("ValidatePrompt(%q, %q) = %v, want an error: %t", test.template, test.color, err, test.wantErr)
+		}
+	}
+}
+
+func TestStripEscapes(t *testing.T) {
+	tests := []struct {
+		prompt string
+		want   string
+	}{
+		{"hub:Admin", "hub:Admin"},
+		{"\x1b[31mhub:Admin\x1b[0m", "hub:Admin"},
+		{"\x01\x1b[1;32m\x02hub\x01\x1b[0m\x02", "hub"},
+		{"hub\x1b]0;title\x07:Admin", "hub0;title:Admin"},
+		{"hub\nAdmin\r\t\x7f", "hubAdmin"},
+		{"\x1b[?25lhub", "hub"},
+	}
+
+	for _, test := range tests {
+		if got := StripEscapes(test.prompt); got != test.want {
+			t.Errorf("StripEscapes(%q) = %q, want %q", test.prompt, got, test.want)
+		}
+	}
+}
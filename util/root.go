@@ -20,16 +20,17 @@
 package util
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"os/user"
+	"sort"
 	"strconv"
-	"syscall"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sts"
 )
@@ -41,26 +42,31 @@ type AwsCreds struct {
 	SessionToken    string
 	Expiration      int64
 	AccountId       string
-}
-
-func WriteSessionFile(awsCreds AwsCreds, fileName string) {
-	awsCredsJSON, _ := json.Marshal(awsCreds)
 
-	createFile(fileName)
-	err := ioutil.WriteFile(fileName, awsCredsJSON, 0600)
-	CheckError(err)
+	// Version is the CacheVersion the session was cached with. Sessions
+	// cached before versioning have none.
+	Version  int             `json:",omitempty"`
+	Metadata SessionMetadata `json:",omitempty"`
 }
 
-func createFile(path string) {
-	// detect if file exists
-	var _, err = os.Stat(path)
+// CacheVersion is the version of the cached session format
+const CacheVersion = 2
 
-	// create file if not exists
-	if os.IsNotExist(err) {
-		var file, err = os.Create(path)
-		CheckError(err)
-		defer file.Close()
-	}
+// SessionMetadata records how a session was started
+type SessionMetadata struct {
+	IssuedAt      int64  `json:",omitempty"`
+	Profile       string `json:",omitempty"`
+	SourceProfile string `json:",omitempty"`
+	RoleArn       string `json:",omitempty"`
+	SessionName   string `json:",omitempty"`
+	Region        string `json:",omitempty"`
+	ExternalId    string `json:",omitempty"`
+	MfaUsed       bool   `json:",omitempty"`
+
+	// MfaUnknown is set on sessions cached by older versions of Portray,
+	// which didn't record whether MFA was used. They're reused as if it was
+	// until they expire.
+	MfaUnknown bool `json:",omitempty"`
 }
 
 func Round(d, r time.Duration) time.Duration {
@@ -89,16 +95,6 @@ func CheckError(err error) {
 	}
 }
 
-func GetCredsFromFile(fileName string) (awsCreds AwsCreds) {
-	file, err := ioutil.ReadFile(fileName)
-	if err != nil {
-		return
-	}
-
-	json.Unmarshal(file, &awsCreds)
-	return
-}
-
 func ValidateSession(awsCreds AwsCreds) (valid bool) {
 	valid = false
 	timestamp := int64(time.Now().Unix())
@@ -108,90 +104,397 @@ func ValidateSession(awsCreds AwsCreds) (valid bool) {
 	return
 }
 
-func GetNewSession(profile string, accountId string, userName string, tokenCode string) (awsCreds AwsCreds) {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		Config:  aws.Config{Region: aws.String("us-east-1")},
+// ValidateSessionFor reports whether a session has at least minRemaining
+// left before it expires.
+func ValidateSessionFor(awsCreds AwsCreds, minRemaining time.Duration) bool {
+	return time.Now().Add(minRemaining).Unix() < awsCreds.Expiration
+}
+
+// DefaultSessionDuration is the duration of MFA sessions from GetNewSession
+// unless another one is requested
+const DefaultSessionDuration = 43200
+
+// DefaultRoleSessionDuration is the duration of role sessions from
+// GetNewRoleSession unless another one is requested
+const DefaultRoleSessionDuration = 3600
+
+// RoleSessionDurationStep is how much shorter each retry of AssumeRole is
+// when the role doesn't allow the requested duration
+const RoleSessionDurationStep = 900
+
+// ChainedRoleSessionDuration is the longest session STS allows for a role
+// assumed with the session of another role
+const ChainedRoleSessionDuration = 3600
+
+// GetNewSession starts an MFA session via STS, exiting if it fails.
+func GetNewSession(profile string, accountId string, userName string, tokenCode string, durationSeconds int64, endpoint StsEndpoint) AwsCreds {
+	awsCreds, err := GetSessionToken(profile, accountId, userName, tokenCode, durationSeconds, endpoint)
+	CheckError(err)
+	return awsCreds
+}
+
+// GetSessionToken starts an MFA session via STS.
+func GetSessionToken(profile string, accountId string, userName string, tokenCode string, durationSeconds int64, endpoint StsEndpoint) (awsCreds AwsCreds, err error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:  *endpoint.Config(),
 		Profile: profile,
-	}))
+	})
+	if err != nil {
+		return
+	}
 	svc := sts.New(sess)
 
+	if durationSeconds == 0 {
+		durationSeconds = DefaultSessionDuration
+	}
+
 	// If no tokenCode is passed, assume MFA has been disabled by a flag
 	var params *sts.GetSessionTokenInput
 	if tokenCode == "" {
 		params = &sts.GetSessionTokenInput{
-			DurationSeconds: aws.Int64(43200),
+			DurationSeconds: aws.Int64(durationSeconds),
 		}
 	} else {
 		params = &sts.GetSessionTokenInput{
-			DurationSeconds: aws.Int64(43200),
-			SerialNumber:    aws.String("arn:aws:iam::" + accountId + ":mfa/" + userName),
+			DurationSeconds: aws.Int64(durationSeconds),
+			SerialNumber:    aws.String(NewIamArn(endpoint.Region, accountId, "mfa/"+userName).String()),
 			TokenCode:       aws.String(tokenCode),
 		}
 	}
 
 	resp, err := svc.GetSessionToken(params)
-	CheckError(err)
+	if err != nil {
+		return
+	}
 
 	awsCreds = AwsCreds{
-		*resp.Credentials.AccessKeyId,
-		*resp.Credentials.SecretAccessKey,
-		*resp.Credentials.SessionToken,
-		resp.Credentials.Expiration.Unix(),
-		accountId,
+		AccessKeyID:     *resp.Credentials.AccessKeyId,
+		SecretAccessKey: *resp.Credentials.SecretAccessKey,
+		SessionToken:    *resp.Credentials.SessionToken,
+		Expiration:      resp.Credentials.Expiration.Unix(),
+		AccountId:       accountId,
+		Version:         CacheVersion,
+		Metadata: SessionMetadata{
+			IssuedAt: time.Now().Unix(),
+			Profile:  profile,
+			Region:   endpoint.Region,
+			MfaUsed:  tokenCode != "",
+		},
 	}
 
 	return
 }
 
-func GetNewRoleSession(accountId string, roleName string, externalId string, usr user.User) (awsCreds AwsCreds) {
-	sess, err := session.NewSession(&aws.Config{Region: aws.String("us-east-1")})
+// RoleSessionInput holds the parameters used to assume a role
+type RoleSessionInput struct {
+	RoleArn    string
+	ExternalId string
+
+	// MfaSerial and TokenCode are passed to AssumeRole for roles that
+	// require MFA when there's no MFA session to assume them with.
+	MfaSerial string
+	TokenCode string
+
+	// SourceCreds is the session used to call AssumeRole, such as the MFA
+	// session of the role's source profile. When it's empty, the credentials
+	// of the AWS CLI profile SourceProfile are used, or the default
+	// credential chain without one.
+	SourceCreds   AwsCreds
+	SourceProfile string
+
+	// DurationSeconds is the requested session duration. If the role's
+	// maximum session duration is lower, the longest allowed multiple of
+	// RoleSessionDurationStep is used instead.
+	DurationSeconds int64
+
+	// Endpoint is where AssumeRole is called
+	Endpoint StsEndpoint
+}
+
+// GetNewRoleSession assumes a role via STS, exiting if it fails.
+func GetNewRoleSession(input RoleSessionInput, usr user.User) AwsCreds {
+	awsCreds, err := AssumeRole(input, usr)
 	CheckError(err)
+	return awsCreds
+}
+
+// AssumeRole assumes a role via STS.
+func AssumeRole(input RoleSessionInput, usr user.User) (awsCreds AwsCreds, err error) {
+	roleArn, err := ParseIamArn(input.RoleArn, "role")
+	if err != nil {
+		return
+	}
+
+	config := input.Endpoint.Config()
+	if input.SourceCreds.SessionToken != "" {
+		config.Credentials = credentials.NewStaticCredentials(
+			input.SourceCreds.AccessKeyID,
+			input.SourceCreds.SecretAccessKey,
+			input.SourceCreds.SessionToken)
+	} else if input.SourceProfile != "" {
+		config.Credentials = credentials.NewSharedCredentials("", input.SourceProfile)
+	}
+
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return
+	}
 	svc := sts.New(sess)
 
 	timestamp := int64(time.Now().Unix())
+	externalId := input.ExternalId
 	if externalId == "" {
 		externalId = usr.Username
 	}
 
+	durationSeconds := input.DurationSeconds
+	if durationSeconds == 0 {
+		durationSeconds = DefaultRoleSessionDuration
+	}
+
 	params := &sts.AssumeRoleInput{
 		ExternalId:      aws.String(externalId),
-		DurationSeconds: aws.Int64(3600),
-		RoleArn:         aws.String("arn:aws:iam::" + accountId + ":role/" + roleName),
+		DurationSeconds: aws.Int64(durationSeconds),
+		RoleArn:         aws.String(roleArn.String()),
 		RoleSessionName: aws.String("Portray-" + usr.Username + "-" + strconv.FormatInt(timestamp, 10)),
 	}
+	if input.MfaSerial != "" && input.TokenCode != "" {
+		params.SerialNumber = aws.String(input.MfaSerial)
+		params.TokenCode = aws.String(input.TokenCode)
+	}
 
+	// STS doesn't tell us the role's maximum session duration, so step down
+	// a quarter of an hour at a time until the duration is accepted.
+	requested := *params.DurationSeconds
 	resp, err := svc.AssumeRole(params)
-	CheckError(err)
+	for isDurationError(err) && *params.DurationSeconds > DefaultRoleSessionDuration {
+		duration := (*params.DurationSeconds - 1) / RoleSessionDurationStep * RoleSessionDurationStep
+		if duration < DefaultRoleSessionDuration {
+			duration = DefaultRoleSessionDuration
+		}
+		params.DurationSeconds = aws.Int64(duration)
+		resp, err = svc.AssumeRole(params)
+	}
+	if err == nil && *params.DurationSeconds != requested {
+		fmt.Fprintf(os.Stderr, "Role %s doesn't allow %v sessions, using %v\n",
+			roleArn.Name(),
+			time.Duration(requested)*time.Second,
+			time.Duration(*params.DurationSeconds)*time.Second)
+	}
+	if err != nil {
+		return
+	}
 
 	awsCreds = AwsCreds{
-		*resp.Credentials.AccessKeyId,
-		*resp.Credentials.SecretAccessKey,
-		*resp.Credentials.SessionToken,
-		resp.Credentials.Expiration.Unix(),
-		accountId,
+		AccessKeyID:     *resp.Credentials.AccessKeyId,
+		SecretAccessKey: *resp.Credentials.SecretAccessKey,
+		SessionToken:    *resp.Credentials.SessionToken,
+		Expiration:      resp.Credentials.Expiration.Unix(),
+		AccountId:       roleArn.AccountId,
+		Version:         CacheVersion,
+		Metadata: SessionMetadata{
+			IssuedAt:    time.Now().Unix(),
+			RoleArn:     roleArn.String(),
+			SessionName: *params.RoleSessionName,
+			Region:      input.Endpoint.Region,
+			ExternalId:  externalId,
+			MfaUsed:     params.TokenCode != nil || input.SourceCreds.Metadata.MfaUsed,
+			MfaUnknown:  params.TokenCode == nil && input.SourceCreds.Metadata.MfaUnknown,
+		},
 	}
 
 	return
 }
 
-func SessionToEnvVars(awsCreds AwsCreds, account string, role string, profile string) {
-	prompt := account
-	if role != "" {
-		prompt = prompt + ":" + role
+// isDurationError reports whether STS rejected a request because the
+// requested DurationSeconds is longer than the role allows.
+func isDurationError(err error) bool {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code() == "ValidationError" && strings.Contains(awsErr.Message(), "DurationSeconds")
 	}
-	if profile != "" {
-		prompt = prompt + ":" + profile
+	return false
+}
+
+// EnvVar is a single environment variable exposed to a session, or removed
+// from it if Unset is set
+type EnvVar struct {
+	Name  string
+	Value string
+	Unset bool
+}
+
+// ConflictingEnv lists the variables that make SDKs and the AWS CLI use
+// another profile or expiration than the session's, so they're unset in
+// sessions
+var ConflictingEnv = []string{"AWS_PROFILE", "AWS_DEFAULT_PROFILE", "AWS_CREDENTIAL_EXPIRATION"}
+
+// PrivateEnv lists the variables only meant for portray itself, which
+// MergeEnv keeps out of the environments of shells and commands
+var PrivateEnv = []string{"PORTRAY_CACHE_PASSPHRASE"}
+
+// ChainSeparator separates the hops of a role chain in PORTRAY_CHAIN and the
+// prompt
+const ChainSeparator = " > "
+
+// SessionInfo describes the profile and role a session belongs to
+type SessionInfo struct {
+	AccountId string
+	RoleName  string
+	Profile   string
+	Region    string
+
+	// Env holds extra variables to set in the session
+	Env map[string]string
+
+	// AccountAlias, Environment and PromptColor describe the account and
+	// profile in PORTRAY_PROMPT, which is rendered with PromptTemplate.
+	AccountAlias   string
+	Environment    string
+	PromptColor    string
+	PromptTemplate string
+
+	// Chain lists the hops of a role chain as account:role, from the first
+	// role assumed to the last.
+	Chain []string
+}
+
+// Prompt returns the account, role and profile of a session as shown in
+// PORTRAY_PROMPT. Role chains are shown as the path of roles assumed.
+func (info SessionInfo) Prompt() string {
+	prompt := info.AccountId
+	if info.RoleName != "" {
+		prompt = prompt + ":" + info.RoleName
+	}
+	if len(info.Chain) > 1 {
+		prompt = strings.Join(info.Chain, ChainSeparator)
+	}
+	if info.Profile != "" {
+		prompt = prompt + ":" + info.Profile
+	}
+	return prompt
+}
+
+// SessionEnv returns the environment variables that expose a session to a
+// shell or child process, including the ConflictingEnv to unset.
+func SessionEnv(awsCreds AwsCreds, info SessionInfo) []EnvVar {
+	var vars []EnvVar
+	for _, name := range ConflictingEnv {
+		vars = append(vars, EnvVar{Name: name, Unset: true})
+	}
+
+	vars = append(vars,
+		EnvVar{Name: "AWS_ACCESS_KEY_ID", Value: awsCreds.AccessKeyID},
+		EnvVar{Name: "AWS_SECRET_ACCESS_KEY", Value: awsCreds.SecretAccessKey},
+		EnvVar{Name: "AWS_SECURITY_TOKEN", Value: awsCreds.SessionToken},
+		EnvVar{Name: "AWS_SESSION_TOKEN", Value: awsCreds.SessionToken})
+
+	if awsCreds.Expiration != 0 {
+		expiration := time.Unix(awsCreds.Expiration, 0)
+		vars = append(vars,
+			EnvVar{Name: "AWS_CREDENTIAL_EXPIRATION", Value: expiration.UTC().Format(time.RFC3339)},
+			EnvVar{Name: "PORTRAY_EXPIRATION", Value: strconv.FormatInt(awsCreds.Expiration, 10)})
+	}
+
+	// A region left over from another session or profile would point the
+	// session at the wrong region, so it's unset when there's none.
+	vars = append(vars,
+		optionalEnvVar("AWS_REGION", info.Region),
+		optionalEnvVar("AWS_DEFAULT_REGION", info.Region),
+		optionalEnvVar("PORTRAY_PROFILE", info.Profile),
+		optionalEnvVar("PORTRAY_ACCOUNT", info.AccountId),
+		optionalEnvVar("PORTRAY_ROLE", info.RoleName))
+
+	var chain string
+	if len(info.Chain) > 1 {
+		chain = strings.Join(info.Chain, ChainSeparator)
+	}
+	vars = append(vars, optionalEnvVar("PORTRAY_CHAIN", chain))
+
+	var names []string
+	for name := range info.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		vars = append(vars, EnvVar{Name: name, Value: info.Env[name]})
+	}
+
+	// PORTRAY_PROMPT ends up in env files and the output of commands, so
+	// it's never colored. Colors are added by the prompt command.
+	plain := info
+	plain.PromptColor = ""
+	prompt, err := plain.RenderPrompt(awsCreds.Expiration, "")
+	if err != nil {
+		prompt = info.Prompt()
+	}
+	return append(vars, EnvVar{Name: "PORTRAY_PROMPT", Value: StripEscapes(prompt)})
+}
+
+// optionalEnvVar sets a variable, or unsets it if the value is empty so it
+// isn't left over from another session.
+func optionalEnvVar(name string, value string) EnvVar {
+	return EnvVar{Name: name, Value: value, Unset: value == ""}
+}
+
+// MinimalEnvNames lists the variables kept from the environment by
+// MinimalEnv, along with any LC_ locale variables
+var MinimalEnvNames = []string{
+	"HOME", "USER", "LOGNAME", "SHELL", "PATH", "TERM", "COLORTERM", "LANG",
+	"TZ", "TMPDIR", "DISPLAY", "SSH_AUTH_SOCK",
+	// Windows
+	"USERPROFILE", "SYSTEMROOT", "COMSPEC", "PATHEXT", "TEMP", "TMP",
+}
+
+// MinimalEnv returns only the variables of environ, in os.Environ form,
+// that are needed to run a shell.
+func MinimalEnv(environ []string) []string {
+	keep := make(map[string]bool)
+	for _, name := range MinimalEnvNames {
+		keep[name] = true
+	}
+
+	var minimal []string
+	for _, kv := range environ {
+		name := strings.SplitN(kv, "=", 2)[0]
+		if keep[strings.ToUpper(name)] || strings.HasPrefix(name, "LC_") {
+			minimal = append(minimal, kv)
+		}
+	}
+
+	return minimal
+}
+
+// MergeEnv returns a copy of environ, in os.Environ form, with vars set or
+// unset and any existing values for them replaced. The PrivateEnv is
+// always removed.
+func MergeEnv(environ []string, vars []EnvVar) []string {
+	replaced := make(map[string]bool)
+	for _, name := range PrivateEnv {
+		replaced[name] = true
+	}
+	for _, v := range vars {
+		replaced[v.Name] = true
+	}
+
+	merged := make([]string, 0, len(environ)+len(vars))
+	for _, kv := range environ {
+		if replaced[strings.SplitN(kv, "=", 2)[0]] {
+			continue
+		}
+		merged = append(merged, kv)
+	}
+	for _, v := range vars {
+		if !v.Unset {
+			merged = append(merged, v.Name+"="+v.Value)
+		}
 	}
 
-	fmt.Println("Setting ENV VARS")
-	os.Setenv("AWS_ACCESS_KEY_ID", awsCreds.AccessKeyID)
-	os.Setenv("AWS_SECRET_ACCESS_KEY", awsCreds.SecretAccessKey)
-	os.Setenv("AWS_SECURITY_TOKEN", awsCreds.SessionToken)
-	os.Setenv("AWS_SESSION_TOKEN", awsCreds.SessionToken)
-	os.Setenv("PORTRAY_PROMPT", prompt)
+	return merged
 }
 
-func StartShell(sessionName string) {
+// StartShell runs a shell with the session until it exits, and returns its
+// exit code.
+func StartShell(sessionName string, shell Shell) int {
 	fmt.Println("Starting shell with Session in: " + sessionName)
-	syscall.Exec(os.Getenv("SHELL"), []string{os.Getenv("SHELL")}, syscall.Environ())
+	return shell.Run()
 }
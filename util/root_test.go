@@ -0,0 +1,205 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os/user"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roleDurationStub is an STS endpoint for roles with a maximum session
+// duration of max seconds, recording the durations asked for.
+func roleDurationStub(max int64, requested *[]int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		duration, _ := strconv.ParseInt(r.Form.Get("DurationSeconds"), 10, 64)
+		*requested = append(*requested, duration)
+
+		w.Header().Set("Content-Type", "text/xml")
+		if duration > max {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `<ErrorResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><Error><Type>Sender</Type><Code>ValidationError</Code><Message>The requested DurationSeconds exceeds the MaxSessionDuration set for this role.</Message></Error><RequestId>1</RequestId></ErrorResponse>`)
+			return
+		}
+		expiration := time.Now().Add(time.Duration(duration) * time.Second).UTC().Format(time.RFC3339)
+		fmt.Fprintf(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><AssumeRoleResult><Credentials><AccessKeyId>ASIAEXAMPLE</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken><Expiration>%s</Expiration></Credentials><AssumedRoleUser><Arn>arn:aws:sts::111111111111:assumed-role/Admin/Portray</Arn><AssumedRoleId>AROAEXAMPLE:Portray</AssumedRoleId></AssumedRoleUser></AssumeRoleResult><ResponseMetadata><RequestId>1</RequestId></ResponseMetadata></AssumeRoleResponse>`, expiration)
+	}))
+}
+
+func TestAssumeRoleDuration(t *testing.T) {
+	tests := []struct {
+		name      string
+		max       int64
+		requested int64
+		want      int64
+	}{
+		{"allowed", 43200, 28800, 28800},
+		{"default", 3600, 0, 3600},
+		{"whole hours", 14400, 28800, 14400},
+		{"hour and a half", 5400, 43200, 5400},
+		{"between steps", 5000, 7200, 4500},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requested []int64
+			server := roleDurationStub(test.max, &requested)
+			defer server.Close()
+
+			input := RoleSessionInput{
+				RoleArn:         "arn:aws:iam::111111111111:role/Admin",
+				SourceCreds:     AwsCreds{AccessKeyID: "AKIAEXAMPLE", SecretAccessKey: "secret", SessionToken: "token"},
+				DurationSeconds: test.requested,
+				Endpoint:        StsEndpoint{Region: "us-east-1", EndpointUrl: server.URL},
+			}
+			_, err := AssumeRole(input, user.User{Username: "test"})
+			if err != nil {
+				t.Fatalf("AssumeRole failed: %s", err)
+			}
+			if got := requested[len(requested)-1]; got != test.want {
+				t.Errorf("AssumeRole got a %ds session, want %ds (asked for %v)", got, test.want, requested)
+			}
+		})
+	}
+}
+
+func TestMergeEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		environ []string
+		vars    []EnvVar
+		want    []string
+	}{
+		{
+			name:    "set",
+			environ: []string{"HOME=/home/user"},
+			vars:    []EnvVar{{Name: "AWS_REGION", Value: "us-east-1"}},
+			want:    []string{"HOME=/home/user", "AWS_REGION=us-east-1"},
+		},
+		{
+			name:    "replace",
+			environ: []string{"AWS_REGION=eu-west-1", "HOME=/home/user"},
+			vars:    []EnvVar{{Name: "AWS_REGION", Value: "us-east-1"}},
+			want:    []string{"HOME=/home/user", "AWS_REGION=us-east-1"},
+		},
+		{
+			name:    "unset",
+			environ: []string{"AWS_PROFILE=dev", "HOME=/home/user"},
+			vars:    []EnvVar{{Name: "AWS_PROFILE", Unset: true}},
+			want:    []string{"HOME=/home/user"},
+		},
+		{
+			name:    "unset missing",
+			environ: []string{"HOME=/home/user"},
+			vars:    []EnvVar{{Name: "AWS_PROFILE", Unset: true}},
+			want:    []string{"HOME=/home/user"},
+		},
+		{
+			name:    "value with equals sign",
+			environ: []string{"TOKEN=a=b"},
+			vars:    []EnvVar{{Name: "TOKEN", Value: "c=d"}},
+			want:    []string{"TOKEN=c=d"},
+		},
+		{
+			name:    "empty value",
+			environ: []string{"PORTRAY_ROLE=Admin"},
+			vars:    []EnvVar{{Name: "PORTRAY_ROLE", Value: ""}},
+			want:    []string{"PORTRAY_ROLE="},
+		},
+		{
+			name:    "private",
+			environ: []string{"PORTRAY_CACHE_PASSPHRASE=secret", "HOME=/home/user"},
+			want:    []string{"HOME=/home/user"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := MergeEnv(test.environ, test.vars)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("MergeEnv = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSessionEnv(t *testing.T) {
+	awsCreds := AwsCreds{AccessKeyID: "ASIAEXAMPLE", SecretAccessKey: "secret", SessionToken: "token", Expiration: 1700000000}
+
+	tests := []struct {
+		name string
+		info SessionInfo
+		want map[string]string
+	}{
+		{
+			name: "role",
+			info: SessionInfo{AccountId: "111111111111", RoleName: "Admin", Profile: "Admin", Region: "eu-west-1", Env: map[string]string{"TF_VAR_env": "dev"}},
+			want: map[string]string{
+				"AWS_ACCESS_KEY_ID":         "ASIAEXAMPLE",
+				"AWS_SESSION_TOKEN":         "token",
+				"AWS_CREDENTIAL_EXPIRATION": "2023-11-14T22:13:20Z",
+				"PORTRAY_EXPIRATION":        "1700000000",
+				"AWS_REGION":                "eu-west-1",
+				"AWS_DEFAULT_REGION":        "eu-west-1",
+				"PORTRAY_PROFILE":           "Admin",
+				"PORTRAY_ROLE":              "Admin",
+				"TF_VAR_env":                "dev",
+				"AWS_PROFILE":               "",
+				"PORTRAY_CHAIN":             "",
+			},
+		},
+		{
+			name: "chain without region",
+			info: SessionInfo{AccountId: "333333333333", RoleName: "Deploy", Chain: []string{"222222222222:Admin", "333333333333:Deploy"}},
+			want: map[string]string{
+				"AWS_REGION":         "",
+				"AWS_DEFAULT_REGION": "",
+				"PORTRAY_PROFILE":    "",
+				"PORTRAY_CHAIN":      "222222222222:Admin > 333333333333:Deploy",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			environ := []string{"AWS_PROFILE=other", "AWS_REGION=us-west-2", "AWS_DEFAULT_REGION=us-west-2", "PORTRAY_PROFILE=old", "PORTRAY_CHAIN=old"}
+			env := make(map[string]string)
+			for _, v := range MergeEnv(environ, SessionEnv(awsCreds, test.info)) {
+				pair := strings.SplitN(v, "=", 2)
+				env[pair[0]] = pair[1]
+			}
+			for name, want := range test.want {
+				got, set := env[name]
+				if want == "" && set {
+					t.Errorf("%s = %q, want it unset", name, got)
+				} else if want != "" && got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ContainerCredentials is the JSON document the AWS SDKs expect from the
+// endpoint in AWS_CONTAINER_CREDENTIALS_FULL_URI
+type ContainerCredentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	Token           string
+	Expiration      string
+}
+
+// containerError is the body of a failed response, which the SDKs turn into
+// the error of the credential provider
+type containerError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewContainerCredentials converts a session to the container credentials
+// format.
+func NewContainerCredentials(awsCreds AwsCreds) ContainerCredentials {
+	return ContainerCredentials{
+		AccessKeyId:     awsCreds.AccessKeyID,
+		SecretAccessKey: awsCreds.SecretAccessKey,
+		Token:           awsCreds.SessionToken,
+		Expiration:      time.Unix(awsCreds.Expiration, 0).UTC().Format(time.RFC3339),
+	}
+}
+
+// ContainerCredentialsHandler serves the session returned by load over the
+// container credentials protocol. Requests must send token in their
+// Authorization header, as the SDKs do with AWS_CONTAINER_AUTHORIZATION_TOKEN.
+// Calls to load are serialized, so it's free to refresh the session.
+func ContainerCredentialsHandler(token string, load func() (AwsCreds, error)) http.Handler {
+	var mutex sync.Mutex
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeContainerError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "only GET is supported")
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(token)) != 1 {
+			writeContainerError(w, http.StatusUnauthorized, "AccessDenied", "missing or invalid authorization token")
+			return
+		}
+
+		mutex.Lock()
+		awsCreds, err := load()
+		mutex.Unlock()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to serve credentials: %s\n", err)
+			writeContainerError(w, http.StatusInternalServerError, "CredentialsUnavailable", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(NewContainerCredentials(awsCreds))
+	})
+}
+
+func writeContainerError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(containerError{Code: code, Message: message})
+}
+
+// ContainerEnv returns the environment variables that point SDKs and the AWS
+// CLI at a container credentials endpoint. The static credentials of a
+// session take precedence over the endpoint, so they're unset along with
+// the ConflictingEnv.
+func ContainerEnv(uri string, token string, region string) []EnvVar {
+	var vars []EnvVar
+	for _, name := range ConflictingEnv {
+		vars = append(vars, EnvVar{Name: name, Unset: true})
+	}
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SECURITY_TOKEN", "AWS_SESSION_TOKEN", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"} {
+		vars = append(vars, EnvVar{Name: name, Unset: true})
+	}
+
+	vars = append(vars,
+		EnvVar{Name: "AWS_CONTAINER_CREDENTIALS_FULL_URI", Value: uri},
+		EnvVar{Name: "AWS_CONTAINER_AUTHORIZATION_TOKEN", Value: token})
+	if region != "" {
+		vars = append(vars,
+			EnvVar{Name: "AWS_REGION", Value: region},
+			EnvVar{Name: "AWS_DEFAULT_REGION", Value: region})
+	}
+	return vars
+}
@@ -0,0 +1,89 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestContainerCredentialsHandler(t *testing.T) {
+	expiration := time.Now().Add(time.Hour).Unix()
+	load := func() (AwsCreds, error) {
+		return AwsCreds{AccessKeyID: "ASIAEXAMPLE", SecretAccessKey: "secret", SessionToken: "token", Expiration: expiration}, nil
+	}
+	failing := func() (AwsCreds, error) {
+		return AwsCreds{}, errors.New("session expired")
+	}
+
+	tests := []struct {
+		name          string
+		method        string
+		authorization string
+		load          func() (AwsCreds, error)
+		wantStatus    int
+		wantCode      string
+	}{
+		{"authorized", http.MethodGet, "secret-token", load, http.StatusOK, ""},
+		{"no token", http.MethodGet, "", load, http.StatusUnauthorized, "AccessDenied"},
+		{"wrong token", http.MethodGet, "secret-tokem", load, http.StatusUnauthorized, "AccessDenied"},
+		{"token prefix", http.MethodGet, "secret", load, http.StatusUnauthorized, "AccessDenied"},
+		{"POST", http.MethodPost, "secret-token", load, http.StatusMethodNotAllowed, "MethodNotAllowed"},
+		{"load error", http.MethodGet, "secret-token", failing, http.StatusInternalServerError, "CredentialsUnavailable"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := ContainerCredentialsHandler("secret-token", test.load)
+			req := httptest.NewRequest(test.method, "/", nil)
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, test.wantStatus, w.Body)
+			}
+			if test.wantCode != "" {
+				var response containerError
+				if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+					t.Fatal(err)
+				}
+				if response.Code != test.wantCode {
+					t.Errorf("code = %q, want %q", response.Code, test.wantCode)
+				}
+				return
+			}
+
+			var creds ContainerCredentials
+			if err := json.Unmarshal(w.Body.Bytes(), &creds); err != nil {
+				t.Fatal(err)
+			}
+			want := NewContainerCredentials(AwsCreds{AccessKeyID: "ASIAEXAMPLE", SecretAccessKey: "secret", SessionToken: "token", Expiration: expiration})
+			if creds != want {
+				t.Errorf("credentials = %+v, want %+v", creds, want)
+			}
+		})
+	}
+}
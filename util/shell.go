@@ -0,0 +1,228 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ExpiryWarnings are how long before a session expires the user is warned
+// about it in a session shell
+var ExpiryWarnings = []time.Duration{10 * time.Minute, time.Minute}
+
+// Shell is an interactive shell started with a session. Portray stays
+// running while the shell does, so it can warn the user before the session
+// expires and renew it.
+type Shell struct {
+	// Path is the shell to run. $SHELL and then DefaultShell are used if
+	// it's empty or can't be started.
+	Path string
+
+	// Env is the environment of the shell, os.Environ() if it's nil
+	Env []string
+
+	// Expiration is when the session expires, in unix time
+	Expiration int64
+
+	// Renew is called RenewBefore the session expires and returns the
+	// renewed session, or false if it can't be renewed.
+	// Renewed sessions are written to EnvFile, which the shell can source
+	// from $PORTRAY_ENV_FILE.
+	Renew       func() (AwsCreds, bool)
+	RenewBefore time.Duration
+	EnvFile     string
+	Info        SessionInfo
+}
+
+// shellEvent is something the supervisor does at a point in the session
+type shellEvent struct {
+	at      time.Time
+	warning time.Duration
+	renew   bool
+	expire  bool
+}
+
+// events returns what's left to do for the current session, in order.
+func (shell *Shell) events() []shellEvent {
+	expiration := time.Unix(shell.Expiration, 0)
+
+	var events []shellEvent
+	for _, warning := range ExpiryWarnings {
+		events = append(events, shellEvent{at: expiration.Add(-warning), warning: warning})
+	}
+	now := time.Now()
+	if shell.Renew != nil {
+		// sessions started with less than RenewBefore left are renewed
+		// right away
+		renewAt := expiration.Add(-shell.RenewBefore)
+		if !renewAt.After(now) {
+			renewAt = now.Add(time.Second)
+		}
+		events = append(events, shellEvent{at: renewAt, renew: true})
+	}
+	events = append(events, shellEvent{at: expiration, expire: true})
+
+	var pending []shellEvent
+	for _, event := range events {
+		if event.at.After(now) {
+			pending = append(pending, event)
+		}
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].at.Before(pending[j].at)
+	})
+
+	return pending
+}
+
+// start starts the first of the configured shell, $SHELL and DefaultShell
+// that can be started.
+func (shell *Shell) start(env []string) (*exec.Cmd, error) {
+	var err error
+	tried := make(map[string]bool)
+	for _, path := range []string{shell.Path, os.Getenv("SHELL"), DefaultShell()} {
+		if path == "" || tried[path] {
+			continue
+		}
+		tried[path] = true
+
+		cmd := exec.Command(path)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = env
+		if err = cmd.Start(); err == nil {
+			return cmd, nil
+		}
+		fmt.Fprintf(os.Stderr, "Unable to start shell %s: %s\n", path, err)
+	}
+	return nil, err
+}
+
+// writeEnvFile writes a session to the EnvFile, in the syntax of the shell.
+func (shell *Shell) writeEnvFile(cmd *exec.Cmd, awsCreds AwsCreds) error {
+	format := "bash"
+	switch strings.TrimSuffix(filepath.Base(cmd.Path), ".exe") {
+	case "fish":
+		format = "fish"
+	case "pwsh", "powershell":
+		format = "powershell"
+	case "cmd":
+		format = "cmd"
+	}
+
+	output, err := FormatEnv(SessionEnv(awsCreds, shell.Info), format)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(shell.EnvFile, []byte(output))
+}
+
+// renew renews the session and writes it to the EnvFile, rescheduling the
+// events of the session.
+func (shell *Shell) renew(cmd *exec.Cmd, events *[]shellEvent) {
+	awsCreds, ok := shell.Renew()
+	if !ok {
+		fmt.Fprintln(os.Stderr, "portray: the session wasn't renewed, exit the shell to start a new one before it expires")
+		return
+	}
+	if err := shell.writeEnvFile(cmd, awsCreds); err != nil {
+		fmt.Fprintf(os.Stderr, "\nportray: unable to write the renewed session: %s\n", err)
+		return
+	}
+
+	shell.Expiration = awsCreds.Expiration
+	if !ValidateSessionFor(awsCreds, shell.RenewBefore) {
+		// the role's sessions are too short to renew them again in time
+		shell.Renew = nil
+	}
+	*events = shell.events()
+	fmt.Fprintln(os.Stderr, "\nportray: session renewed, load it with: . \"$PORTRAY_ENV_FILE\"")
+}
+
+// Run runs the shell until it exits and returns its exit code. Signals are
+// relayed to the shell with a signalRelay.
+func (shell *Shell) Run() int {
+	env := shell.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	if shell.Renew != nil {
+		env = MergeEnv(env, []EnvVar{{Name: "PORTRAY_ENV_FILE", Value: shell.EnvFile}})
+	}
+
+	// interactive shells handle job control themselves
+	signals := catchSignals(terminalSignals)
+	defer signals.stop()
+
+	cmd, err := shell.start(env)
+	if err != nil {
+		return 127
+	}
+	signals.relay(cmd.Process)
+
+	if shell.Renew != nil {
+		defer os.Remove(shell.EnvFile)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	events := shell.events()
+	for {
+		var next <-chan time.Time
+		var timer *time.Timer
+		if len(events) > 0 {
+			timer = time.NewTimer(events[0].at.Sub(time.Now()))
+			next = timer.C
+		}
+
+		select {
+		case err := <-done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return exitCode(err)
+		case <-next:
+			event := events[0]
+			events = events[1:]
+
+			switch {
+			case event.warning != 0:
+				fmt.Fprintf(os.Stderr, "\nportray: session credentials expire in %v\n", event.warning)
+			case event.renew:
+				shell.renew(cmd, &events)
+			case event.expire:
+				fmt.Fprintln(os.Stderr, "\nportray: session credentials have expired, exit the shell to start a new session")
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
@@ -0,0 +1,283 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CredentialStore caches sessions by key. Get returns empty credentials,
+// and no error, for keys that aren't in the store.
+type CredentialStore interface {
+	Get(key string) (AwsCreds, error)
+	Put(key string, awsCreds AwsCreds) error
+	Delete(key string) error
+	List() ([]string, error)
+}
+
+// FileStore caches sessions as JSON files named portray-<key>.json in a
+// directory. Encrypted files are always decrypted, but new files are only
+// encrypted if Encryption is enabled. Without Encryption, sessions are stored
+// in plaintext and encrypted files are ignored.
+type FileStore struct {
+	Dir        string
+	Encryption *CacheEncryption
+}
+
+// Path returns the path of the session file for a key.
+func (store *FileStore) Path(key string) string {
+	return filepath.Join(store.Dir, "portray-"+key+".json")
+}
+
+// Encrypted reports whether new session files are encrypted.
+func (store *FileStore) Encrypted() bool {
+	return store.Encryption != nil && store.Encryption.Enabled
+}
+
+func (store *FileStore) Get(key string) (awsCreds AwsCreds, err error) {
+	fileName := store.Path(key)
+	file, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return awsCreds, nil
+	} else if err != nil {
+		return
+	}
+
+	if IsEncrypted(file) {
+		if store.Encryption == nil {
+			fmt.Fprintf(os.Stderr, "Ignoring session cache %s: session is encrypted, but cache encryption isn't configured\n", fileName)
+			return awsCreds, nil
+		}
+		file, err = store.Encryption.Decrypt(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ignoring session cache %s: %s\n", fileName, err)
+			return awsCreds, nil
+		}
+	}
+
+	if err := json.Unmarshal(file, &awsCreds); err != nil {
+		fmt.Fprintf(os.Stderr, "Ignoring session cache %s: %s\n", fileName, err)
+		return AwsCreds{}, nil
+	}
+	return awsCreds, nil
+}
+
+func (store *FileStore) Put(key string, awsCreds AwsCreds) error {
+	awsCredsJSON, err := json.Marshal(awsCreds)
+	if err != nil {
+		return err
+	}
+
+	if store.Encrypted() {
+		awsCredsJSON, err = store.Encryption.Encrypt(awsCredsJSON)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeFileAtomic(store.Path(key), awsCredsJSON)
+}
+
+func (store *FileStore) Delete(key string) error {
+	err := os.Remove(store.Path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (store *FileStore) List() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(store.Dir, "portray-*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, file := range files {
+		key := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "portray-"), ".json")
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// writeFileAtomic writes a file readable only by the user via a temporary
+// file that's renamed into place, so readers never see a partial file.
+func writeFileAtomic(fileName string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(fileName), "."+filepath.Base(fileName))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), fileName)
+}
+
+// MemoryStore keeps sessions in memory only, so nothing is written to disk
+// and every portray invocation starts new sessions.
+type MemoryStore struct {
+	sessions map[string]AwsCreds
+}
+
+func (store *MemoryStore) Get(key string) (AwsCreds, error) {
+	return store.sessions[key], nil
+}
+
+func (store *MemoryStore) Put(key string, awsCreds AwsCreds) error {
+	if store.sessions == nil {
+		store.sessions = make(map[string]AwsCreds)
+	}
+	store.sessions[key] = awsCreds
+	return nil
+}
+
+func (store *MemoryStore) Delete(key string) error {
+	delete(store.sessions, key)
+	return nil
+}
+
+func (store *MemoryStore) List() ([]string, error) {
+	var keys []string
+	for key := range store.sessions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// StoreCommands are the shell commands a CommandStore runs, with the key in
+// $PORTRAY_CACHE_KEY. Get prints the session JSON, Put reads it from stdin,
+// and List prints one key per line. A failing Get means the key isn't in the
+// store.
+type StoreCommands struct {
+	Get    string
+	Put    string
+	Delete string
+	List   string
+}
+
+// PassCommands stores sessions in pass, the standard unix password manager
+var PassCommands = StoreCommands{
+	Get:    `pass show "portray/$PORTRAY_CACHE_KEY"`,
+	Put:    `pass insert --multiline --force "portray/$PORTRAY_CACHE_KEY" >/dev/null`,
+	Delete: `pass rm --force "portray/$PORTRAY_CACHE_KEY" >/dev/null`,
+	List:   `find "${PASSWORD_STORE_DIR:-$HOME/.password-store}/portray" -name '*.gpg' 2>/dev/null | sed 's|.*/||; s|\.gpg$||'`,
+}
+
+// SecretServiceCommands stores sessions in the Secret Service, e.g. GNOME
+// Keyring or KWallet, via secret-tool
+var SecretServiceCommands = StoreCommands{
+	Get:    `secret-tool lookup service portray key "$PORTRAY_CACHE_KEY"`,
+	Put:    `secret-tool store --label="portray $PORTRAY_CACHE_KEY" service portray key "$PORTRAY_CACHE_KEY"`,
+	Delete: `secret-tool clear service portray key "$PORTRAY_CACHE_KEY"`,
+	List:   `secret-tool search --all service portray 2>&1 | sed -n 's/^attribute.key = //p'`,
+}
+
+// CommandStore keeps sessions in an external secret store, such as pass or
+// the Secret Service, by running shell commands.
+type CommandStore struct {
+	Commands StoreCommands
+}
+
+func (store *CommandStore) Get(key string) (awsCreds AwsCreds, err error) {
+	output, err := store.run(store.Commands.Get, key, nil)
+	if err != nil {
+		return awsCreds, nil
+	}
+
+	err = json.Unmarshal(output, &awsCreds)
+	return
+}
+
+func (store *CommandStore) Put(key string, awsCreds AwsCreds) error {
+	awsCredsJSON, err := json.Marshal(awsCreds)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.run(store.Commands.Put, key, awsCredsJSON)
+	return err
+}
+
+func (store *CommandStore) Delete(key string) error {
+	_, err := store.run(store.Commands.Delete, key, nil)
+	return err
+}
+
+func (store *CommandStore) List() ([]string, error) {
+	output, err := store.run(store.Commands.List, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, key := range strings.Split(string(output), "\n") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// run runs a store command with sh, passing input on stdin, and returns
+// its output.
+func (store *CommandStore) run(command string, key string, input []byte) ([]byte, error) {
+	if command == "" {
+		return nil, fmt.Errorf("no cache command configured")
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = MergeEnv(os.Environ(), []EnvVar{{Name: "PORTRAY_CACHE_KEY", Value: key}})
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %s %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return output, nil
+}
@@ -0,0 +1,161 @@
+// Copyright © 2017 Jason Myers <jason@mailthemyers.com>
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// testStore checks that a store keeps, lists and deletes sessions.
+func testStore(t *testing.T, store CredentialStore) {
+	if awsCreds, err := store.Get("session-dev"); err != nil || awsCreds.AccessKeyID != "" {
+		t.Fatalf("Get of a missing key = %+v, %v, want empty credentials", awsCreds, err)
+	}
+
+	dev := AwsCreds{AccessKeyID: "ASIADEV", SecretAccessKey: "secret", SessionToken: "token", Expiration: 1700000000, Version: CacheVersion}
+	admin := AwsCreds{AccessKeyID: "ASIAADMIN", SecretAccessKey: "secret", SessionToken: "token", Expiration: 1700000000, Version: CacheVersion}
+	if err := store.Put("session-dev", dev); err != nil {
+		t.Fatalf("Put failed: %s", err)
+	}
+	if err := store.Put("role-session-Admin", admin); err != nil {
+		t.Fatalf("Put failed: %s", err)
+	}
+
+	got, err := store.Get("session-dev")
+	if err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	if !reflect.DeepEqual(got, dev) {
+		t.Errorf("Get = %+v, want %+v", got, dev)
+	}
+
+	keys, err := store.List()
+	if err != nil {
+		t.Fatalf("List failed: %s", err)
+	}
+	if want := []string{"role-session-Admin", "session-dev"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("List = %q, want %q", keys, want)
+	}
+
+	if err := store.Delete("session-dev"); err != nil {
+		t.Fatalf("Delete failed: %s", err)
+	}
+	if got, _ := store.Get("session-dev"); got.AccessKeyID != "" {
+		t.Errorf("Get after Delete = %+v, want empty credentials", got)
+	}
+	keys, _ = store.List()
+	if want := []string{"role-session-Admin"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("List after Delete = %q, want %q", keys, want)
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "portray-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestFileStore(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	testStore(t, &FileStore{Dir: dir})
+
+	info, err := os.Stat(filepath.Join(dir, "portray-role-session-Admin.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("session file mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestFileStoreEncrypted(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	passphrase := func() string { return "correct horse" }
+
+	store := &FileStore{Dir: dir, Encryption: &CacheEncryption{Enabled: true, Passphrase: passphrase}}
+	testStore(t, store)
+
+	data, err := ioutil.ReadFile(store.Path("role-session-Admin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(data) {
+		t.Errorf("session file isn't encrypted: %s", data)
+	}
+
+	// without Encryption, encrypted sessions are ignored
+	plain := &FileStore{Dir: dir}
+	if got, err := plain.Get("role-session-Admin"); err != nil || got.AccessKeyID != "" {
+		t.Errorf("Get without Encryption = %+v, %v, want empty credentials", got, err)
+	}
+	// and with it, they're read even when new ones aren't encrypted
+	disabled := &FileStore{Dir: dir, Encryption: &CacheEncryption{Passphrase: passphrase}}
+	if got, err := disabled.Get("role-session-Admin"); err != nil || got.AccessKeyID != "ASIAADMIN" {
+		t.Errorf("Get with Encryption disabled = %+v, %v, want the session", got, err)
+	}
+}
+
+func TestFileStoreCorrupt(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	store := &FileStore{Dir: dir}
+	if err := ioutil.WriteFile(store.Path("session-dev"), []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.Get("session-dev"); err != nil || got.AccessKeyID != "" {
+		t.Errorf("Get of a corrupt file = %+v, %v, want empty credentials", got, err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, &MemoryStore{})
+}
+
+func TestCommandStore(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("store commands are run with sh")
+	}
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	os.Setenv("PORTRAY_TEST_STORE", dir)
+	defer os.Unsetenv("PORTRAY_TEST_STORE")
+
+	testStore(t, &CommandStore{Commands: StoreCommands{
+		Get:    `cat "$PORTRAY_TEST_STORE/$PORTRAY_CACHE_KEY"`,
+		Put:    `cat > "$PORTRAY_TEST_STORE/$PORTRAY_CACHE_KEY"`,
+		Delete: `rm "$PORTRAY_TEST_STORE/$PORTRAY_CACHE_KEY"`,
+		List:   `ls "$PORTRAY_TEST_STORE"`,
+	}})
+
+	if _, err := (&CommandStore{}).List(); err == nil {
+		t.Error("List without a command succeeded, want an error")
+	}
+}